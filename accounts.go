@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	authCookieName      = "prodle_auth"
+	authSessionDuration = 30 * 24 * time.Hour
+	minPasswordLength   = 8
+	maxPasswordLength   = 72
+)
+
+// Compared against when the username is unknown so that login timing does not reveal which accounts exist.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("prodle-dummy-password"), bcrypt.DefaultCost)
+
+type AccountRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type AccountResponse struct {
+	Success  bool     `json:"success"`
+	Message  string   `json:"message,omitempty"`
+	Code     string   `json:"code,omitempty"`
+	Account  *Account `json:"account,omitempty"`
+	LoggedIn bool     `json:"loggedIn"`
+}
+
+func ValidateAccountCredentials(username, password string) (bool, string) {
+	if username != SanitizeInput(username) {
+		return false, "Username contains invalid characters"
+	}
+
+	if len(username) < 3 || len(username) > 50 {
+		return false, "Username must be between 3 and 50 characters"
+	}
+
+	if len(password) < minPasswordLength {
+		return false, "Password must be at least 8 characters long"
+	}
+
+	if len(password) > maxPasswordLength {
+		return false, "Password is too long"
+	}
+
+	return true, ""
+}
+
+func setAuthCookie(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func startAuthSession(w http.ResponseWriter, r *http.Request, account *Account) error {
+	token, err := generateSessionID()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(authSessionDuration)
+	if err := store.CreateAuthSession(token, account.ID, expiresAt); err != nil {
+		return err
+	}
+
+	setAuthCookie(w, r, token, expiresAt)
+
+	// Runs played anonymously on this browser now belong to the account
+	if playerID := CurrentPlayerID(r); playerID != "" {
+		if err := store.LinkPlayerRunsToAccount(playerID, account.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Error linking anonymous runs", "account", account.Username, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// CurrentAccount returns the logged-in account for a request, or nil for anonymous players.
+func CurrentAccount(r *http.Request) *Account {
+	cookie, err := r.Cookie(authCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	account, err := store.GetAccountByAuthToken(cookie.Value)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error looking up auth session", "error", err)
+		return nil
+	}
+
+	return account
+}
+
+// IsReservedUsername reports whether a username belongs to a registered account, lookalikes included.
+func IsReservedUsername(username string) (bool, error) {
+	account, err := store.GetAccountByFoldedUsername(username)
+	if err != nil {
+		return false, err
+	}
+	return account != nil, nil
+}
+
+func writeAccountResponse(w http.ResponseWriter, status int, response AccountResponse) {
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req AccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAccountResponse(w, http.StatusBadRequest, AccountResponse{Message: "Invalid request format"})
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if valid, errMsg := ValidateAccountCredentials(username, req.Password); !valid {
+		writeAccountResponse(w, http.StatusBadRequest, AccountResponse{Message: errMsg})
+		return
+	}
+
+	username, err := usernamePolicy.Check(username, false)
+	if err != nil {
+		response := AccountResponse{Message: err.Error()}
+		if usernameErr, ok := err.(*UsernameError); ok {
+			response.Code = usernameErr.Code
+		}
+		writeAccountResponse(w, http.StatusBadRequest, response)
+		return
+	}
+
+	existing, err := store.GetAccountByFoldedUsername(username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error checking account", "account", username, "error", err)
+		writeAccountResponse(w, http.StatusInternalServerError, AccountResponse{Message: "Failed to create account"})
+		return
+	}
+
+	if existing != nil {
+		writeAccountResponse(w, http.StatusConflict, AccountResponse{Message: "Username is already taken"})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
+		writeAccountResponse(w, http.StatusInternalServerError, AccountResponse{Message: "Failed to create account"})
+		return
+	}
+
+	account, err := store.CreateAccount(username, string(passwordHash))
+	if errors.Is(err, ErrUsernameTaken) {
+		writeAccountResponse(w, http.StatusConflict, AccountResponse{Message: "Username is already taken"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating account", "account", username, "error", err)
+		writeAccountResponse(w, http.StatusInternalServerError, AccountResponse{Message: "Failed to create account"})
+		return
+	}
+
+	if err := startAuthSession(w, r, account); err != nil {
+		slog.ErrorContext(r.Context(), "Error starting auth session", "account", username, "error", err)
+		writeAccountResponse(w, http.StatusInternalServerError, AccountResponse{Message: "Account created but login failed"})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Account created", "account", account.Username)
+
+	writeAccountResponse(w, http.StatusOK, AccountResponse{Success: true, Account: account, LoggedIn: true})
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req AccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAccountResponse(w, http.StatusBadRequest, AccountResponse{Message: "Invalid request format"})
+		return
+	}
+
+	account, err := store.GetAccountByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error loading account", "account", req.Username, "error", err)
+		writeAccountResponse(w, http.StatusInternalServerError, AccountResponse{Message: "Login failed"})
+		return
+	}
+
+	passwordHash := dummyPasswordHash
+	if account != nil {
+		passwordHash = []byte(account.PasswordHash)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(req.Password)); err != nil || account == nil {
+		writeAccountResponse(w, http.StatusUnauthorized, AccountResponse{Message: "Invalid username or password"})
+		return
+	}
+
+	if err := startAuthSession(w, r, account); err != nil {
+		slog.ErrorContext(r.Context(), "Error starting auth session", "account", account.Username, "error", err)
+		writeAccountResponse(w, http.StatusInternalServerError, AccountResponse{Message: "Login failed"})
+		return
+	}
+
+	writeAccountResponse(w, http.StatusOK, AccountResponse{Success: true, Account: account, LoggedIn: true})
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if cookie, err := r.Cookie(authCookieName); err == nil {
+		if err := store.DeleteAuthSession(cookie.Value); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting auth session", "error", err)
+		}
+	}
+
+	setAuthCookie(w, r, "", time.Unix(0, 0))
+
+	writeAccountResponse(w, http.StatusOK, AccountResponse{Success: true})
+}
+
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	account := CurrentAccount(r)
+
+	writeAccountResponse(w, http.StatusOK, AccountResponse{Success: true, Account: account, LoggedIn: account != nil})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	adminPageSize   = 50
+	adminLogSize    = 100
+	adminTokenActor = "admin-token"
+)
+
+type AdminEntryView struct {
+	LeaderboardEntry
+	FormattedDate     string
+	FormattedDuration string
+}
+
+type AdminPageData struct {
+	Actor    string
+	Entries  []AdminEntryView
+	Bans     []Ban
+	Log      []ModerationAction
+	Page     int
+	PrevPage int
+	NextPage int
+	Error    string
+}
+
+// requireAdmin lets in accounts with the admin role and requests carrying the ADMIN_TOKEN as a bearer token,
+// and returns who is acting for the moderation log. Admin endpoints look like they do not exist
+// when no token is configured and the visitor is not an admin.
+func requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if account := CurrentAccount(r); account != nil && account.Role == AccountRoleAdmin {
+		return account.Username, true
+	}
+
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		http.NotFound(w, r)
+		return "", false
+	}
+
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="prodle-admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+
+	return adminTokenActor, true
+}
+
+// requireAdminForm guards the console's form posts. The auth cookie is SameSite=Lax, and a cross-site
+// Origin is refused as well so a third-party page cannot drive the console.
+func requireAdminForm(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Host != r.Host {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return "", false
+		}
+	}
+
+	return requireAdmin(w, r)
+}
+
+func redirectToAdmin(w http.ResponseWriter, r *http.Request, message string) {
+	target := "/admin"
+	query := url.Values{}
+	if page, err := strconv.Atoi(r.FormValue("page")); err == nil && page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if message != "" {
+		query.Set("error", message)
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func describeEntry(entry *LeaderboardEntry) string {
+	return fmt.Sprintf("%s, %d points on %s (%s), run %s", entry.Username, entry.Score, entry.Difficulty, entry.Date.Format(time.RFC3339), entry.RunID)
+}
+
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	page, ok := queryInt(r, "page", 1, 1<<20)
+	if !ok {
+		page = 1
+	}
+
+	entries, err := store.GetRecentLeaderboardEntries((page-1)*adminPageSize, adminPageSize+1)
+	if err != nil {
+		http.Error(w, "Error loading submissions", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading recent submissions", "error", err)
+		return
+	}
+
+	bans, err := store.GetBans()
+	if err != nil {
+		http.Error(w, "Error loading bans", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading bans", "error", err)
+		return
+	}
+
+	actions, err := store.GetModerationLog(adminLogSize)
+	if err != nil {
+		http.Error(w, "Error loading moderation log", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading moderation log", "error", err)
+		return
+	}
+
+	data := AdminPageData{
+		Actor: actor,
+		Bans:  bans,
+		Log:   actions,
+		Page:  page,
+		Error: r.URL.Query().Get("error"),
+	}
+
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if len(entries) > adminPageSize {
+		entries = entries[:adminPageSize]
+		data.NextPage = page + 1
+	}
+
+	for _, entry := range entries {
+		data.Entries = append(data.Entries, AdminEntryView{
+			LeaderboardEntry:  entry,
+			FormattedDate:     entry.Date.Format("2006-01-02 15:04"),
+			FormattedDuration: FormatDuration(entry.Duration),
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	err = templates.ExecuteTemplate(w, "admin.html", data)
+	if err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template error", "template", "admin.html", "error", err)
+	}
+}
+
+func adminEntryHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireAdminForm(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	entry, err := store.GetLeaderboardEntry(id)
+	if err != nil {
+		http.Error(w, "Error loading entry", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading leaderboard entry", "entry", id, "error", err)
+		return
+	}
+	if entry == nil {
+		redirectToAdmin(w, r, fmt.Sprintf("Entry %d no longer exists", id))
+		return
+	}
+
+	action := ModerationAction{
+		Actor:   actor,
+		Action:  r.PathValue("action"),
+		Target:  fmt.Sprintf("entry %d", id),
+		Details: describeEntry(entry),
+	}
+
+	switch action.Action {
+	case "hide", "unhide":
+		_, err = store.SetLeaderboardEntryHidden(id, action.Action == "hide", action)
+	case "delete":
+		_, err = store.DeleteLeaderboardEntry(id, action)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Error moderating entry", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error moderating leaderboard entry", "entry", id, "error", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Moderation", "actor", actor, "action", action.Action, "target", action.Target, "details", action.Details)
+	redirectToAdmin(w, r, "")
+}
+
+func adminBanHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireAdminForm(w, r)
+	if !ok {
+		return
+	}
+
+	kind := r.FormValue("kind")
+	value, err := normalizeBanValue(kind, r.FormValue("value"))
+	if err != nil {
+		redirectToAdmin(w, r, err.Error())
+		return
+	}
+
+	ban := Ban{
+		Kind:      kind,
+		Value:     value,
+		Reason:    strings.TrimSpace(r.FormValue("reason")),
+		CreatedBy: actor,
+	}
+
+	action := ModerationAction{
+		Actor:   actor,
+		Action:  "ban",
+		Target:  kind + " " + value,
+		Details: ban.Reason,
+	}
+
+	if err := store.AddBan(ban, action); err != nil {
+		http.Error(w, "Error adding ban", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error adding ban", "kind", kind, "value", value, "error", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Moderation", "actor", actor, "action", action.Action, "target", action.Target)
+	redirectToAdmin(w, r, "")
+}
+
+func adminUnbanHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireAdminForm(w, r)
+	if !ok {
+		return
+	}
+
+	kind := r.FormValue("kind")
+	value := r.FormValue("value")
+
+	action := ModerationAction{
+		Actor:  actor,
+		Action: "unban",
+		Target: kind + " " + value,
+	}
+
+	if _, err := store.RemoveBan(kind, value, action); err != nil {
+		http.Error(w, "Error removing ban", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error removing ban", "kind", kind, "value", value, "error", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Moderation", "actor", actor, "action", action.Action, "target", action.Target)
+	redirectToAdmin(w, r, "")
+}
+
+func runRoleCommand(args []string) error {
+	if len(args) != 2 || (args[1] != AccountRoleAdmin && args[1] != AccountRolePlayer) {
+		return fmt.Errorf("usage: prodle role <username> admin|player")
+	}
+
+	if err := InitDatabase(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	username, role := args[0], args[1]
+	action := ModerationAction{
+		Actor:   "cli",
+		Action:  "set role",
+		Target:  "account " + username,
+		Details: role,
+	}
+
+	found, err := store.SetAccountRole(username, role, action)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no account named %s", username)
+	}
+
+	slog.Info("Account role changed", "account", username, "role", role)
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// Entries scoring this much or more are hidden until a moderator reviews them
+	suspicionThreshold = 50
+	maxSuspicion       = 100
+
+	minHumanGuessInterval = time.Second
+	maxAutocompleteCalls  = 5000
+
+	// Signals need this many guesses before they mean anything
+	minGuessesForTiming = 8
+)
+
+const (
+	FlagSubSecondGuesses = "sub_second_guesses"
+	FlagFirstGuessStreak = "first_guess_streak"
+	FlagNoAutocomplete   = "no_autocomplete"
+	FlagUniformTiming    = "uniform_timing"
+)
+
+type RunAnalysis struct {
+	Suspicion int      `json:"suspicion"`
+	Flags     []string `json:"flags"`
+}
+
+func (a RunAnalysis) Flagged() bool {
+	return a.Suspicion >= suspicionThreshold
+}
+
+// RecordAutocomplete notes an autocomplete lookup. Players typing a name trigger one before nearly
+// every guess; a script posting guesses directly does not.
+func RecordAutocomplete(sessionID string, now time.Time) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	session, exists := activeSessions[sessionID]
+	if !exists || session.IsCompleted || len(session.AutocompleteTimes) >= maxAutocompleteCalls {
+		return
+	}
+
+	session.AutocompleteTimes = append(session.AutocompleteTimes, now)
+}
+
+type timedGuess struct {
+	at       time.Time
+	interval time.Duration
+}
+
+// sessionGuesses lists every guess with the time since the previous one, or since its target appeared.
+func sessionGuesses(gs *GameSession) []timedGuess {
+	var guesses []timedGuess
+	for _, target := range gs.Targets {
+		previous := target.StartTime
+		for _, guess := range target.Guesses {
+			guesses = append(guesses, timedGuess{at: guess.Timestamp, interval: guess.Timestamp.Sub(previous)})
+			previous = guess.Timestamp
+		}
+	}
+	return guesses
+}
+
+// AnalyzeSession scores how implausible a finished run is for a human, from 0 to 100.
+func AnalyzeSession(gs *GameSession) RunAnalysis {
+	var analysis RunAnalysis
+	guesses := sessionGuesses(gs)
+
+	add := func(flag string, points int) {
+		if points <= 0 {
+			return
+		}
+		analysis.Flags = append(analysis.Flags, flag)
+		analysis.Suspicion += points
+	}
+
+	add(FlagSubSecondGuesses, subSecondGuessPoints(guesses))
+	add(FlagFirstGuessStreak, firstGuessStreakPoints(gs.Targets))
+	add(FlagNoAutocomplete, noAutocompletePoints(guesses, gs.AutocompleteTimes))
+	add(FlagUniformTiming, uniformTimingPoints(guesses))
+
+	analysis.Suspicion = min(analysis.Suspicion, maxSuspicion)
+	return analysis
+}
+
+// Reading the clues and typing a name takes well over a second.
+func subSecondGuessPoints(guesses []timedGuess) int {
+	fast := 0
+	for _, guess := range guesses {
+		if guess.interval < minHumanGuessInterval {
+			fast++
+		}
+	}
+
+	if fast < 2 {
+		return 0
+	}
+	return min(50, fast*10)
+}
+
+// A few lucky first guesses happen; a long unbroken run of them does not.
+func firstGuessStreakPoints(targets []TargetAttempt) int {
+	streak, longest := 0, 0
+	for _, target := range targets {
+		if target.Outcome == TargetFound && len(target.Guesses) == 1 {
+			streak++
+			longest = max(longest, streak)
+		} else if target.Outcome != TargetUnplayed {
+			streak = 0
+		}
+	}
+
+	if longest < 4 {
+		return 0
+	}
+	return min(40, (longest-3)*10)
+}
+
+// Counts guesses with no autocomplete lookup since the previous guess.
+func noAutocompletePoints(guesses []timedGuess, lookups []time.Time) int {
+	if len(guesses) < minGuessesForTiming {
+		return 0
+	}
+
+	sorted := append([]time.Time(nil), lookups...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	unassisted := 0
+	next := 0
+	for _, guess := range guesses {
+		since := guess.at.Add(-guess.interval)
+		for next < len(sorted) && !sorted[next].After(since) {
+			next++
+		}
+		if next >= len(sorted) || sorted[next].After(guess.at) {
+			unassisted++
+		}
+	}
+
+	ratio := float64(unassisted) / float64(len(guesses))
+	if ratio < 0.5 {
+		return 0
+	}
+	return int(math.Round(ratio * 30))
+}
+
+// Scripts sleeping a fixed delay between requests produce near-identical gaps; people never do.
+func uniformTimingPoints(guesses []timedGuess) int {
+	if len(guesses) < minGuessesForTiming {
+		return 0
+	}
+
+	var sum float64
+	for _, guess := range guesses {
+		sum += guess.interval.Seconds()
+	}
+	mean := sum / float64(len(guesses))
+	if mean <= 0 {
+		return 30
+	}
+
+	var variance float64
+	for _, guess := range guesses {
+		variance += math.Pow(guess.interval.Seconds()-mean, 2)
+	}
+	deviation := math.Sqrt(variance / float64(len(guesses)))
+
+	switch variation := deviation / mean; {
+	case variation < 0.05:
+		return 40
+	case variation < 0.15:
+		return 20
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+type testTarget struct {
+	gaps    []time.Duration // between the target appearing or the previous guess and each guess
+	outcome TargetOutcome
+}
+
+func found(gaps ...time.Duration) testTarget {
+	return testTarget{gaps: gaps, outcome: TargetFound}
+}
+
+func missed(gaps ...time.Duration) testTarget {
+	return testTarget{gaps: gaps, outcome: TargetMissed}
+}
+
+// testSession plays targets back to back, looking a name up halfway through each gap the
+// assisted function picks by guess number.
+func testSession(targets []testTarget, assisted func(guess int) bool) *GameSession {
+	session := &GameSession{}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	guess := 0
+
+	for _, target := range targets {
+		attempt := TargetAttempt{StartTime: now, Outcome: target.outcome}
+		for _, gap := range target.gaps {
+			if assisted(guess) {
+				session.AutocompleteTimes = append(session.AutocompleteTimes, now.Add(gap/2))
+			}
+			now = now.Add(gap)
+			attempt.Guesses = append(attempt.Guesses, GuessResult{Timestamp: now})
+			guess++
+		}
+		session.Targets = append(session.Targets, attempt)
+	}
+
+	return session
+}
+
+func always(int) bool { return true }
+func never(int) bool  { return false }
+
+func seconds(values ...float64) []time.Duration {
+	durations := make([]time.Duration, len(values))
+	for i, value := range values {
+		durations[i] = time.Duration(value * float64(time.Second))
+	}
+	return durations
+}
+
+func repeat(target testTarget, count int) []testTarget {
+	targets := make([]testTarget, count)
+	for i := range targets {
+		targets[i] = target
+	}
+	return targets
+}
+
+func TestAnalyzeSession(t *testing.T) {
+	// Nine guesses at uneven human speed, never finding a player on the first guess.
+	human := []testTarget{
+		found(seconds(4, 2.5)...),
+		found(seconds(6, 3, 2)...),
+		found(seconds(3.5, 8)...),
+		found(seconds(5, 2)...),
+	}
+
+	tests := []struct {
+		name      string
+		targets   []testTarget
+		assisted  func(int) bool
+		suspicion int
+		flags     []string
+	}{
+		{"human", human, always, 0, nil},
+		{"one sub-second guess", []testTarget{
+			found(seconds(0.4, 2.5)...), found(seconds(6, 3, 2)...), found(seconds(3.5, 8)...), found(seconds(5, 2)...),
+		}, always, 0, nil},
+		{"sub-second guesses", []testTarget{
+			found(seconds(0.4, 2.5)...), found(seconds(6, 0.4, 2)...), found(seconds(3.5, 0.4)...), found(seconds(5, 2)...),
+		}, always, 30, []string{FlagSubSecondGuesses}},
+		{"sub-second guesses capped", repeat(found(seconds(0.5, 3)...), 8), always, 50, []string{FlagSubSecondGuesses}},
+		{"three first guesses in a row", []testTarget{
+			found(seconds(4)...), found(seconds(6)...), found(seconds(3)...), found(seconds(5, 2)...),
+		}, always, 0, nil},
+		{"first guess streak", []testTarget{
+			found(seconds(4)...), found(seconds(6)...), found(seconds(3)...), found(seconds(9)...), found(seconds(5)...), found(seconds(3, 2)...),
+		}, always, 20, []string{FlagFirstGuessStreak}},
+		{"unplayed targets do not break a streak", []testTarget{
+			found(seconds(4)...), found(seconds(6)...), found(seconds(3)...), {outcome: TargetUnplayed}, found(seconds(5)...),
+		}, always, 10, []string{FlagFirstGuessStreak}},
+		{"missed targets break a streak", []testTarget{
+			found(seconds(4)...), found(seconds(6)...), found(seconds(3)...), missed(seconds(5, 4)...), found(seconds(5)...), found(seconds(7)...),
+		}, always, 0, nil},
+		{"no autocomplete", human, never, 30, []string{FlagNoAutocomplete}},
+		{"autocomplete for every other guess", human, func(guess int) bool { return guess%2 == 0 }, 0, nil},
+		{"autocomplete for a third of guesses", human, func(guess int) bool { return guess%3 == 0 }, 20, []string{FlagNoAutocomplete}},
+		{"too few guesses to judge autocomplete", human[:3], never, 0, nil},
+		{"uniform timing", []testTarget{
+			found(seconds(3, 3)...), found(seconds(3, 3, 3)...), found(seconds(3, 3)...), found(seconds(3, 3)...),
+		}, always, 40, []string{FlagUniformTiming}},
+		{"nearly uniform timing", []testTarget{
+			found(seconds(2.7, 3.3)...), found(seconds(2.7, 3.3, 2.7)...), found(seconds(3.3, 2.7)...), found(seconds(3.3, 2.7, 3.3)...),
+		}, always, 20, []string{FlagUniformTiming}},
+		{"too few guesses to judge timing", []testTarget{found(seconds(3, 3)...), found(seconds(3, 3)...)}, always, 0, nil},
+		{"script", repeat(found(seconds(0.3)...), 10), never, maxSuspicion,
+			[]string{FlagSubSecondGuesses, FlagFirstGuessStreak, FlagNoAutocomplete, FlagUniformTiming}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := AnalyzeSession(testSession(tt.targets, tt.assisted))
+			if analysis.Suspicion != tt.suspicion {
+				t.Errorf("suspicion = %d, want %d (flags %v)", analysis.Suspicion, tt.suspicion, analysis.Flags)
+			}
+			if !slices.Equal(analysis.Flags, tt.flags) {
+				t.Errorf("flags = %v, want %v", analysis.Flags, tt.flags)
+			}
+		})
+	}
+}
+
+func TestRunAnalysisFlagged(t *testing.T) {
+	tests := []struct {
+		suspicion int
+		want      bool
+	}{
+		{0, false},
+		{suspicionThreshold - 1, false},
+		{suspicionThreshold, true},
+		{maxSuspicion, true},
+	}
+
+	for _, tt := range tests {
+		if got := (RunAnalysis{Suspicion: tt.suspicion}).Flagged(); got != tt.want {
+			t.Errorf("Flagged() with suspicion %d = %v, want %v", tt.suspicion, got, tt.want)
+		}
+	}
+
+	// A single signal is not enough to hide an entry, two together are.
+	uniform := AnalyzeSession(testSession(repeat(found(seconds(3, 3)...), 5), always))
+	if uniform.Flagged() {
+		t.Errorf("uniform timing alone flagged the run: %+v", uniform)
+	}
+	uniformAndFast := AnalyzeSession(testSession(repeat(found(seconds(0.5, 0.5)...), 5), always))
+	if !uniformAndFast.Flagged() {
+		t.Errorf("uniform sub-second guesses not flagged: %+v", uniformAndFast)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const backupFilePrefix = "prodle-"
+
+type BackupConfig struct {
+	Dir      string
+	Interval time.Duration
+	Retain   int
+}
+
+type BackupResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	File    string `json:"file,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+}
+
+// LoadBackupConfig reads BACKUP_DIR, BACKUP_INTERVAL and BACKUP_RETAIN.
+// Backups go next to the database by default and are only scheduled when an interval is set.
+func LoadBackupConfig(config DatabaseConfig) (BackupConfig, error) {
+	backup := BackupConfig{
+		Dir:    os.Getenv("BACKUP_DIR"),
+		Retain: 7,
+	}
+
+	if backup.Dir == "" {
+		backup.Dir = filepath.Join(filepath.Dir(config.Path), "backups")
+	}
+
+	if value := os.Getenv("BACKUP_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			return backup, fmt.Errorf("invalid BACKUP_INTERVAL %q", value)
+		}
+		backup.Interval = interval
+	}
+
+	if value := os.Getenv("BACKUP_RETAIN"); value != "" {
+		retain, err := strconv.Atoi(value)
+		if err != nil || retain < 1 {
+			return backup, fmt.Errorf("invalid BACKUP_RETAIN %q", value)
+		}
+		backup.Retain = retain
+	}
+
+	return backup, nil
+}
+
+// CreateBackup snapshots the database into the backup directory and prunes old snapshots.
+func CreateBackup(config BackupConfig) (string, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	path := filepath.Join(config.Dir, backupFilePrefix+time.Now().UTC().Format("20060102-150405.000")+".db")
+	if err := store.Backup(path); err != nil {
+		return "", err
+	}
+
+	if err := pruneBackups(config.Dir, config.Retain); err != nil {
+		slog.Error("Error pruning backups", "error", err)
+	}
+
+	return path, nil
+}
+
+// pruneBackups keeps the newest retain snapshots; their timestamped names sort chronologically.
+func pruneBackups(dir string, retain int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, ".db") {
+			backups = append(backups, name)
+		}
+	}
+
+	if len(backups) <= retain {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-retain] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		slog.Info("Removed old backup", "file", name)
+	}
+
+	return nil
+}
+
+func StartBackupScheduler(config BackupConfig) {
+	if config.Interval == 0 {
+		return
+	}
+
+	slog.Info("Scheduled database backups", "interval", config.Interval, "dir", config.Dir, "retain", config.Retain)
+
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			path, err := CreateBackup(config)
+			if err != nil {
+				slog.Error("Error creating scheduled backup", "error", err)
+				continue
+			}
+			slog.Info("Scheduled backup written", "path", path)
+		}
+	}()
+}
+
+// ValidateBackup checks a snapshot is an intact prodle database this version can migrate.
+func ValidateBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("failed to check backup integrity: %v", err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("backup failed integrity check: %s", integrity)
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("backup has no schema version, it is not a prodle database: %v", err)
+	}
+
+	latest := sqliteMigrations[len(sqliteMigrations)-1].Version
+	if version == 0 || version > latest {
+		return 0, fmt.Errorf("backup schema version %d is not supported, this version supports up to %d", version, latest)
+	}
+
+	return version, nil
+}
+
+// RestoreBackup replaces the database with a snapshot. The server must be stopped.
+// The current database is snapshotted first so a bad restore can be undone.
+func RestoreBackup(config DatabaseConfig, path string) error {
+	if config.IsPostgres() {
+		return fmt.Errorf("restore is only supported for SQLite, use pg_restore for PostgreSQL")
+	}
+
+	version, err := ValidateBackup(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(config.Path); err == nil {
+		current, err := NewSQLiteStore(config.SQLiteDSN())
+		if err != nil {
+			return fmt.Errorf("failed to open current database: %v", err)
+		}
+
+		previous := config.Path + ".pre-restore-" + time.Now().UTC().Format("20060102-150405")
+		err = current.Backup(previous)
+		current.Close()
+		if err != nil {
+			return err
+		}
+		slog.Info("Current database saved", "path", previous)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create database directory: %v", err)
+	}
+
+	// A leftover write-ahead log would be replayed on top of the restored file
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(config.Path + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", config.Path+suffix, err)
+		}
+	}
+
+	if err := copyFile(path, config.Path); err != nil {
+		return fmt.Errorf("failed to swap in backup: %v", err)
+	}
+
+	slog.Info("Restored backup", "backup", path, "schema_version", version, "path", config.Path)
+	return nil
+}
+
+func runBackupCommand(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: prodle backup [file]")
+	}
+
+	if err := InitDatabase(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if len(args) == 1 {
+		if err := store.Backup(args[0]); err != nil {
+			return err
+		}
+		fmt.Println(args[0])
+		return nil
+	}
+
+	config, err := LoadBackupConfig(databaseConfig)
+	if err != nil {
+		return err
+	}
+
+	path, err := CreateBackup(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(path)
+	return nil
+}
+
+func runRestoreCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: prodle restore <file> (stop the server first)")
+	}
+
+	config, err := LoadDatabaseConfig()
+	if err != nil {
+		return err
+	}
+
+	return RestoreBackup(config, args[0])
+}
+
+func adminBackupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	config, err := LoadBackupConfig(databaseConfig)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error loading backup config", "error", err)
+		response := BackupResponse{
+			Success: false,
+			Message: "Backups are misconfigured",
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	path, err := CreateBackup(config)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating admin backup", "error", err)
+		response := BackupResponse{
+			Success: false,
+			Message: "Failed to create backup",
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Admin backup written", "path", path)
+
+	response := BackupResponse{
+		Success: true,
+		File:    filepath.Base(path),
+	}
+	if info, err := os.Stat(path); err == nil {
+		response.Size = info.Size()
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
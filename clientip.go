@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var trustedProxies []*net.IPNet
+
+// forceSecureCookies marks cookies Secure on every response, for proxies that do not send X-Forwarded-Proto.
+var forceSecureCookies bool
+
+// LoadTrustedProxies reads TRUSTED_PROXIES, a comma-separated list of IPs or CIDR ranges
+// whose X-Forwarded-For header is believed.
+func LoadTrustedProxies() ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, value := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			value = fmt.Sprintf("%s/%d", ip, bits)
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", value)
+		}
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// LoadCookieSecurity reads COOKIE_SECURE. Without it cookies are Secure when the request came over HTTPS.
+func LoadCookieSecurity() (bool, error) {
+	value := os.Getenv("COOKIE_SECURE")
+	if value == "" {
+		return false, nil
+	}
+
+	secure, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid COOKIE_SECURE %q", value)
+	}
+	return secure, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address the request came from, without the port. Behind trusted proxies it is
+// the nearest X-Forwarded-For hop that is not itself a trusted proxy; hops further left can be forged.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+// isHTTPS reports whether the client used HTTPS, either to this server directly or to a trusted proxy
+// that says so in X-Forwarded-Proto. The header is ignored from anyone else, who could simply set it.
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip) {
+		return false
+	}
+
+	// A proxy chain may append one value per hop; the first is what the client used
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+func secureCookie(r *http.Request) bool {
+	return forceSecureCookies || isHTTPS(r)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "", "203.0.113.9:4242", nil, "203.0.113.9"},
+		{"direct without port", "", "203.0.113.9", nil, "203.0.113.9"},
+		{"direct IPv6", "", "[2001:db8::1]:443", nil, "2001:db8::1"},
+		{"untrusted peer forging the header", "", "203.0.113.9:4242", []string{"198.51.100.7"}, "203.0.113.9"},
+		{"untrusted peer outside the trusted range", "10.0.0.0/8", "203.0.113.9:4242", []string{"198.51.100.7"}, "203.0.113.9"},
+		{"trusted proxy", "10.0.0.1", "10.0.0.1:4242", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"trusted proxy without the header", "10.0.0.1", "10.0.0.1:4242", nil, "10.0.0.1"},
+		{"client prepending a forged hop", "10.0.0.0/8", "10.0.0.1:4242", []string{"6.6.6.6, 198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.0/8", "10.0.0.1:4242", []string{"198.51.100.7, 10.0.0.3, 10.0.0.2"}, "198.51.100.7"},
+		{"hops over several headers", "10.0.0.0/8", "10.0.0.1:4242", []string{"6.6.6.6, 198.51.100.7", "10.0.0.2"}, "198.51.100.7"},
+		{"only trusted hops", "10.0.0.0/8", "10.0.0.1:4242", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"garbage hop stops the walk", "10.0.0.0/8", "10.0.0.1:4242", []string{"198.51.100.7, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"garbage header", "10.0.0.1", "10.0.0.1:4242", []string{"unknown"}, "10.0.0.1"},
+		{"IPv6 proxy", "2001:db8::/32", "[2001:db8::5]:443", []string{"2001:db8:ffff::1, 2001:db8::6"}, "2001:db8:ffff::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTrustedProxies(t, tt.trusted)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func withTrustedProxies(t *testing.T, value string) {
+	t.Helper()
+	t.Setenv("TRUSTED_PROXIES", value)
+
+	proxies, err := LoadTrustedProxies()
+	if err != nil {
+		t.Fatalf("LoadTrustedProxies: %v", err)
+	}
+
+	previous := trustedProxies
+	trustedProxies = proxies
+	t.Cleanup(func() { trustedProxies = previous })
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value    string
+		contains []string
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"10.0.0.1", []string{"10.0.0.1"}, false},
+		{" 10.0.0.0/8 , ::1 ", []string{"10.255.0.1", "::1"}, false},
+		{"not-an-ip", nil, true},
+		{"10.0.0.0/33", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.value)
+
+			proxies, err := LoadTrustedProxies()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadTrustedProxies(%q) = %v, want an error", tt.value, proxies)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadTrustedProxies(%q): %v", tt.value, err)
+			}
+
+			for _, address := range tt.contains {
+				found := false
+				for _, network := range proxies {
+					found = found || network.Contains(net.ParseIP(address))
+				}
+				if !found {
+					t.Errorf("%s is not trusted by %q", address, tt.value)
+				}
+			}
+		})
+	}
+}
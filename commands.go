@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+// runCommand runs a maintenance subcommand instead of the server, e.g. `prodle backup`.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "backup":
+		return runBackupCommand(args)
+	case "restore":
+		return runRestoreCommand(args)
+	case "export":
+		return runExportCommand(args)
+	case "import":
+		return runImportCommand(args)
+	case "role":
+		return runRoleCommand(args)
+	case "verify":
+		return runVerifyCommand(args)
+	default:
+		return fmt.Errorf("unknown command %q (available: backup, restore, export, import, role, verify)", name)
+	}
+}
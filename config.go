@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// ScoringSettings price a found player: BasePoints, less TimeFactor of it as the clock runs out and
+// WrongGuessPenalty per wrong guess, never below MinPoints. Finding the whole lineup adds CompletionBonus.
+type ScoringSettings struct {
+	BasePoints        int     `json:"basePoints"`
+	TimeFactor        float64 `json:"timeFactor"`
+	WrongGuessPenalty int     `json:"wrongGuessPenalty"`
+	MinPoints         int     `json:"minPoints"`
+	CompletionBonus   int     `json:"completionBonus"`
+}
+
+// GameSettings are the rules a game is played and scored with. Each session keeps its own copy,
+// so changing the configuration never changes a game already in progress.
+type GameSettings struct {
+	TotalGameTimeSeconds int             `json:"totalGameTimeSeconds"`
+	PlayersPerSession    int             `json:"playersPerSession"`
+	Scoring              ScoringSettings `json:"scoring"`
+}
+
+type GameConfig struct {
+	Defaults     GameSettings            `json:"defaults"`
+	Difficulties map[string]GameSettings `json:"difficulties"`
+}
+
+var DefaultGameSettings = GameSettings{
+	TotalGameTimeSeconds: 120,
+	PlayersPerSession:    20,
+	Scoring: ScoringSettings{
+		BasePoints:        5000,
+		TimeFactor:        0.7,
+		WrongGuessPenalty: 100,
+		MinPoints:         300,
+		CompletionBonus:   10000,
+	},
+}
+
+var gameConfig = newGameConfig(DefaultGameSettings)
+
+func newGameConfig(defaults GameSettings) GameConfig {
+	config := GameConfig{Defaults: defaults, Difficulties: make(map[string]GameSettings)}
+	for _, difficulty := range []string{DifficultyFacile, DifficultyMoyen, DifficultyDifficile} {
+		config.Difficulties[difficulty] = defaults
+	}
+	return config
+}
+
+// For returns the settings of a difficulty, the defaults for one without overrides.
+func (c GameConfig) For(difficulty string) GameSettings {
+	if settings, ok := c.Difficulties[difficulty]; ok {
+		return settings
+	}
+	return c.Defaults
+}
+
+func (s GameSettings) Validate() error {
+	switch {
+	case s.TotalGameTimeSeconds < 1:
+		return fmt.Errorf("totalGameTimeSeconds must be positive, got %d", s.TotalGameTimeSeconds)
+	case s.PlayersPerSession < 1:
+		return fmt.Errorf("playersPerSession must be positive, got %d", s.PlayersPerSession)
+	case s.Scoring.BasePoints < 1:
+		return fmt.Errorf("scoring.basePoints must be positive, got %d", s.Scoring.BasePoints)
+	case s.Scoring.TimeFactor < 0 || s.Scoring.TimeFactor > 1:
+		return fmt.Errorf("scoring.timeFactor must be between 0 and 1, got %g", s.Scoring.TimeFactor)
+	case s.Scoring.WrongGuessPenalty < 0:
+		return fmt.Errorf("scoring.wrongGuessPenalty must not be negative, got %d", s.Scoring.WrongGuessPenalty)
+	case s.Scoring.MinPoints < 0 || s.Scoring.MinPoints > s.Scoring.BasePoints:
+		return fmt.Errorf("scoring.minPoints must be between 0 and basePoints, got %d", s.Scoring.MinPoints)
+	case s.Scoring.CompletionBonus < 0:
+		return fmt.Errorf("scoring.completionBonus must not be negative, got %d", s.Scoring.CompletionBonus)
+	}
+	return nil
+}
+
+// CheckPlayerPools rejects settings dealing more players than a difficulty has, which would
+// quietly shorten every lineup. poolSize reports how many players a difficulty draws from.
+func (c GameConfig) CheckPlayerPools(poolSize func(difficulty string) int) error {
+	for _, difficulty := range slices.Sorted(maps.Keys(c.Difficulties)) {
+		wanted, available := c.Difficulties[difficulty].PlayersPerSession, poolSize(difficulty)
+		if wanted > available {
+			return fmt.Errorf("playersPerSession for %s is %d, but only %d players are available", difficulty, wanted, available)
+		}
+	}
+	return nil
+}
+
+// decodeStrict decodes data on top of the values already in v, rejecting unknown fields so a typo
+// in the file fails at startup instead of silently keeping a default.
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+type gameConfigFile struct {
+	GameSettings
+	Difficulties map[string]json.RawMessage `json:"difficulties"`
+}
+
+var gameSettingsEnv = []struct {
+	name  string
+	apply func(s *GameSettings, value string) error
+}{
+	{"GAME_TIME_LIMIT", func(s *GameSettings, value string) error {
+		return parseEnvInt(value, &s.TotalGameTimeSeconds)
+	}},
+	{"GAME_PLAYERS_PER_SESSION", func(s *GameSettings, value string) error {
+		return parseEnvInt(value, &s.PlayersPerSession)
+	}},
+	{"SCORE_BASE_POINTS", func(s *GameSettings, value string) error {
+		return parseEnvInt(value, &s.Scoring.BasePoints)
+	}},
+	{"SCORE_TIME_FACTOR", func(s *GameSettings, value string) error {
+		factor, err := strconv.ParseFloat(value, 64)
+		s.Scoring.TimeFactor = factor
+		return err
+	}},
+	{"SCORE_WRONG_GUESS_PENALTY", func(s *GameSettings, value string) error {
+		return parseEnvInt(value, &s.Scoring.WrongGuessPenalty)
+	}},
+	{"SCORE_MIN_POINTS", func(s *GameSettings, value string) error {
+		return parseEnvInt(value, &s.Scoring.MinPoints)
+	}},
+	{"SCORE_COMPLETION_BONUS", func(s *GameSettings, value string) error {
+		return parseEnvInt(value, &s.Scoring.CompletionBonus)
+	}},
+}
+
+func parseEnvInt(value string, target *int) error {
+	parsed, err := strconv.Atoi(value)
+	*target = parsed
+	return err
+}
+
+// applyGameSettingsEnv sets every field whose GAME_* or SCORE_* variable is set.
+func applyGameSettingsEnv(s *GameSettings) error {
+	for _, env := range gameSettingsEnv {
+		if value := os.Getenv(env.name); value != "" {
+			if err := env.apply(s, value); err != nil {
+				return fmt.Errorf("invalid %s %q", env.name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadGameConfig builds the game rules from the built-in defaults, then the JSON file named by
+// GAME_CONFIG, then the GAME_* and SCORE_* variables. The file's "difficulties" object overrides
+// any of the same fields for one difficulty, e.g. {"difficulties": {"facile": {"totalGameTimeSeconds": 150}}}.
+// The variables apply last, to every difficulty, so they win over the file's overrides too.
+func LoadGameConfig() (GameConfig, error) {
+	file := gameConfigFile{GameSettings: DefaultGameSettings}
+
+	path := os.Getenv("GAME_CONFIG")
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return GameConfig{}, fmt.Errorf("failed to read game config: %v", err)
+		}
+		if err := decodeStrict(data, &file); err != nil {
+			return GameConfig{}, fmt.Errorf("invalid game config %s: %v", path, err)
+		}
+	}
+
+	config := newGameConfig(file.GameSettings)
+	for difficulty, overrides := range file.Difficulties {
+		if _, ok := config.Difficulties[difficulty]; !ok {
+			return GameConfig{}, fmt.Errorf("invalid game config %s: unknown difficulty %q", path, difficulty)
+		}
+
+		settings := file.GameSettings
+		if err := decodeStrict(overrides, &settings); err != nil {
+			return GameConfig{}, fmt.Errorf("invalid game config %s: %s: %v", path, difficulty, err)
+		}
+		config.Difficulties[difficulty] = settings
+	}
+
+	if err := applyGameSettingsEnv(&config.Defaults); err != nil {
+		return GameConfig{}, err
+	}
+	if err := config.Defaults.Validate(); err != nil {
+		return GameConfig{}, fmt.Errorf("invalid game config: %v", err)
+	}
+
+	for _, difficulty := range slices.Sorted(maps.Keys(config.Difficulties)) {
+		settings := config.Difficulties[difficulty]
+		if err := applyGameSettingsEnv(&settings); err != nil {
+			return GameConfig{}, err
+		}
+		if err := settings.Validate(); err != nil {
+			return GameConfig{}, fmt.Errorf("invalid game config for %s: %v", difficulty, err)
+		}
+		config.Difficulties[difficulty] = settings
+	}
+
+	return config, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckPlayerPools(t *testing.T) {
+	tests := []struct {
+		name    string
+		pools   map[string]int
+		wantErr string
+	}{
+		{"pools large enough", map[string]int{"facile": 50, "moyen": 50, "difficile": 50}, ""},
+		{"exact fit", map[string]int{"facile": 20, "moyen": 20, "difficile": 20}, ""},
+		{"short pool", map[string]int{"facile": 50, "moyen": 12, "difficile": 50}, "playersPerSession for moyen is 20, but only 12 players are available"},
+		{"empty pool", map[string]int{"facile": 50, "moyen": 50}, "playersPerSession for difficile is 20, but only 0 players are available"},
+	}
+
+	config := newGameConfig(DefaultGameSettings)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := config.CheckPlayerPools(func(difficulty string) int { return tt.pools[difficulty] })
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckPlayerPools: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// settingsWith returns the built-in defaults with change applied.
+func settingsWith(change func(s *GameSettings)) GameSettings {
+	settings := DefaultGameSettings
+	change(&settings)
+	return settings
+}
+
+func TestLoadGameConfig(t *testing.T) {
+	longer := settingsWith(func(s *GameSettings) { s.TotalGameTimeSeconds = 150 })
+
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		want    GameConfig
+		wantErr string
+	}{
+		{
+			name: "built-in defaults",
+			want: newGameConfig(DefaultGameSettings),
+		},
+		{
+			name: "file defaults",
+			file: `{"totalGameTimeSeconds": 150}`,
+			want: newGameConfig(longer),
+		},
+		{
+			name: "file difficulty on top of file defaults",
+			file: `{"totalGameTimeSeconds": 150, "difficulties": {"facile": {"scoring": {"basePoints": 6000}}}}`,
+			want: GameConfig{Defaults: longer, Difficulties: map[string]GameSettings{
+				DifficultyFacile: settingsWith(func(s *GameSettings) {
+					s.TotalGameTimeSeconds = 150
+					s.Scoring.BasePoints = 6000
+				}),
+				DifficultyMoyen:     longer,
+				DifficultyDifficile: longer,
+			}},
+		},
+		{
+			name: "env over file defaults",
+			file: `{"totalGameTimeSeconds": 150, "playersPerSession": 10}`,
+			env:  map[string]string{"GAME_TIME_LIMIT": "90", "SCORE_TIME_FACTOR": "0.5"},
+			want: newGameConfig(settingsWith(func(s *GameSettings) {
+				s.TotalGameTimeSeconds = 90
+				s.PlayersPerSession = 10
+				s.Scoring.TimeFactor = 0.5
+			})),
+		},
+		{
+			name: "env over file difficulty",
+			file: `{"difficulties": {"difficile": {"totalGameTimeSeconds": 60, "playersPerSession": 10}}}`,
+			env:  map[string]string{"GAME_TIME_LIMIT": "90"},
+			want: GameConfig{
+				Defaults: settingsWith(func(s *GameSettings) { s.TotalGameTimeSeconds = 90 }),
+				Difficulties: map[string]GameSettings{
+					DifficultyFacile: settingsWith(func(s *GameSettings) { s.TotalGameTimeSeconds = 90 }),
+					DifficultyMoyen:  settingsWith(func(s *GameSettings) { s.TotalGameTimeSeconds = 90 }),
+					DifficultyDifficile: settingsWith(func(s *GameSettings) {
+						s.TotalGameTimeSeconds = 90
+						s.PlayersPerSession = 10
+					}),
+				},
+			},
+		},
+		{
+			name:    "typo in defaults",
+			file:    `{"totalGameTimeSecond": 150}`,
+			wantErr: `unknown field "totalGameTimeSecond"`,
+		},
+		{
+			name:    "typo in difficulty",
+			file:    `{"difficulties": {"moyen": {"scoring": {"basePoint": 6000}}}}`,
+			wantErr: `moyen: json: unknown field "basePoint"`,
+		},
+		{
+			name:    "unknown difficulty",
+			file:    `{"difficulties": {"expert": {"totalGameTimeSeconds": 60}}}`,
+			wantErr: `unknown difficulty "expert"`,
+		},
+		{
+			name:    "malformed file",
+			file:    `{"totalGameTimeSeconds": }`,
+			wantErr: "invalid game config",
+		},
+		{
+			name:    "time limit not positive",
+			file:    `{"totalGameTimeSeconds": 0}`,
+			wantErr: "totalGameTimeSeconds must be positive, got 0",
+		},
+		{
+			name:    "time factor above one",
+			env:     map[string]string{"SCORE_TIME_FACTOR": "1.5"},
+			wantErr: "scoring.timeFactor must be between 0 and 1, got 1.5",
+		},
+		{
+			name:    "min points above base points",
+			file:    `{"difficulties": {"facile": {"scoring": {"minPoints": 6000}}}}`,
+			wantErr: "invalid game config for facile: scoring.minPoints must be between 0 and basePoints, got 6000",
+		},
+		{
+			name:    "negative penalty",
+			env:     map[string]string{"SCORE_WRONG_GUESS_PENALTY": "-1"},
+			wantErr: "scoring.wrongGuessPenalty must not be negative, got -1",
+		},
+		{
+			name: "env overrides an invalid file difficulty into range",
+			file: `{"difficulties": {"facile": {"playersPerSession": 0}}}`,
+			env:  map[string]string{"GAME_PLAYERS_PER_SESSION": "15"},
+			want: newGameConfig(settingsWith(func(s *GameSettings) { s.PlayersPerSession = 15 })),
+		},
+		{
+			name:    "env not a number",
+			env:     map[string]string{"GAME_PLAYERS_PER_SESSION": "twenty"},
+			wantErr: `invalid GAME_PLAYERS_PER_SESSION "twenty"`,
+		},
+		{
+			name:    "env float not a number",
+			env:     map[string]string{"SCORE_TIME_FACTOR": "high"},
+			wantErr: `invalid SCORE_TIME_FACTOR "high"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range gameSettingsEnv {
+				t.Setenv(env.name, tt.env[env.name])
+			}
+
+			t.Setenv("GAME_CONFIG", "")
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "game.json")
+				if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("GAME_CONFIG", path)
+			}
+
+			config, err := LoadGameConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadGameConfig: %v", err)
+			}
+			if !reflect.DeepEqual(config, tt.want) {
+				t.Errorf("config = %+v, want %+v", config, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadGameConfigMissingFile(t *testing.T) {
+	t.Setenv("GAME_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+
+	if _, err := LoadGameConfig(); err == nil || !strings.Contains(err.Error(), "failed to read game config") {
+		t.Fatalf("err = %v, want a read error", err)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"os"
 	"sort"
@@ -16,6 +18,7 @@ var (
 	allPlayers    []Player
 	playerNames   []string
 	playersByName map[string]Player
+	datasetHash   string
 	dataLoaded    bool
 	dataMutex     sync.RWMutex
 )
@@ -35,10 +38,30 @@ func InitializeGameData() error {
 	initializePlayerLookup()
 
 	dataLoaded = true
-	log.Printf("Game data initialized successfully: %d players loaded", len(allPlayers))
+	slog.Info("Game data initialized", "players", len(allPlayers))
 	return nil
 }
 
+func IsGameDataLoaded() bool {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+
+	return dataLoaded
+}
+
+// GetDatasetInfo identifies the loaded prodle.json by its content hash, so two servers reporting
+// the same version serve the same players.
+func GetDatasetInfo() DatasetInfo {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+
+	info := DatasetInfo{SHA256: datasetHash, Players: len(allPlayers)}
+	if len(datasetHash) >= 12 {
+		info.Version = datasetHash[:12]
+	}
+	return info
+}
+
 func LoadPlayers() error {
 	data, err := os.ReadFile("data/prodle.json")
 	if err != nil {
@@ -54,8 +77,11 @@ func LoadPlayers() error {
 		populateCompatibilityFields(&players[i])
 	}
 
+	sum := sha256.Sum256(data)
+	datasetHash = hex.EncodeToString(sum[:])
+
 	allPlayers = players
-	log.Printf("Loaded %d players from prodle.json", len(allPlayers))
+	slog.Debug("Loaded players from prodle.json", "players", len(allPlayers))
 	return nil
 }
 
@@ -116,6 +142,18 @@ func GetPlayerByName(name string) (*Player, bool) {
 	return &player, exists
 }
 
+// GetPlayerNameKeys returns every name a pro player can be looked up by, usernames and real names.
+func GetPlayerNameKeys() []string {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+
+	names := make([]string, 0, len(playersByName))
+	for name := range playersByName {
+		names = append(names, name)
+	}
+	return names
+}
+
 func GetAllTeams() []string {
 	dataMutex.RLock()
 	defer dataMutex.RUnlock()
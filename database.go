@@ -1,160 +1,78 @@
 package main
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
-var db *sql.DB
+var databaseConfig DatabaseConfig
 
 func InitDatabase() error {
 	var err error
-	db, err = sql.Open("sqlite3", "./prodle.db")
+	databaseConfig, err = LoadDatabaseConfig()
 	if err != nil {
-		return fmt.Errorf("failed to open database: %v", err)
-	}
-
-	if err = db.Ping(); err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
+		return err
 	}
 
-	if err = createTables(); err != nil {
-		return fmt.Errorf("failed to create tables: %v", err)
+	store, err = OpenStore(databaseConfig)
+	if err != nil {
+		return err
 	}
 
-	log.Println("Database initialized successfully")
+	slog.Info("Database initialized")
 	return nil
 }
 
-func createTables() error {
-
-	difficulties := []string{"facile", "moyen", "difficile"}
-
-	for _, difficulty := range difficulties {
-		leaderboardQuery := fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS leaderboard_%s (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT NOT NULL,
-			score INTEGER NOT NULL,
-			date DATETIME NOT NULL,
-			duration INTEGER NOT NULL,
-			guess_count INTEGER NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`, difficulty)
-
-		if _, err := db.Exec(leaderboardQuery); err != nil {
-			return fmt.Errorf("failed to create leaderboard_%s table: %v", difficulty, err)
-		}
-	}
-
-	legacyLeaderboardQuery := `
-	CREATE TABLE IF NOT EXISTS leaderboard (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT NOT NULL,
-		score INTEGER NOT NULL,
-		date DATETIME NOT NULL,
-		duration INTEGER NOT NULL,
-		guess_count INTEGER NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(legacyLeaderboardQuery); err != nil {
-		return fmt.Errorf("failed to create leaderboard table: %v", err)
-	}
-
-	for _, difficulty := range difficulties {
-		indexQuery := fmt.Sprintf(`
-		CREATE INDEX IF NOT EXISTS idx_leaderboard_%s_score 
-		ON leaderboard_%s(score DESC, duration ASC);`, difficulty, difficulty)
+func (s *sqlStore) AddLeaderboardEntryByDifficulty(entry LeaderboardEntry, difficulty string) error {
 
-		if _, err := db.Exec(indexQuery); err != nil {
-			return fmt.Errorf("failed to create leaderboard_%s index: %v", difficulty, err)
-		}
+	validDifficulties := map[string]bool{
+		"facile":    true,
+		"moyen":     true,
+		"difficile": true,
 	}
 
-	legacyIndexQuery := `
-	CREATE INDEX IF NOT EXISTS idx_leaderboard_score 
-	ON leaderboard(score DESC, duration ASC);`
-
-	if _, err := db.Exec(legacyIndexQuery); err != nil {
-		return fmt.Errorf("failed to create legacy leaderboard index: %v", err)
+	if !validDifficulties[difficulty] {
+		return fmt.Errorf("invalid difficulty: %s", difficulty)
 	}
 
-	return nil
-}
-
-func AddLeaderboardEntry(entry LeaderboardEntry) error {
 	query := `
-	INSERT INTO leaderboard (username, score, date, duration, guess_count)
-	VALUES (?, ?, ?, ?, ?)`
+	INSERT INTO leaderboard_entries (difficulty, mode, username, score, date, duration, guess_count, run_id, account_id, player_id, ip, hidden, suspicion, suspicion_flags)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := db.Exec(query, entry.Username, entry.Score, entry.Date, entry.Duration, entry.GuessCount)
-	if err != nil {
-		return fmt.Errorf("failed to add leaderboard entry: %v", err)
+	mode := entry.Mode
+	if mode == "" {
+		mode = GameModeClassic
 	}
 
-	return nil
-}
-
-func GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
-	query := `
-	SELECT username, score, date, duration, guess_count
-	FROM leaderboard
-	ORDER BY score DESC, duration ASC
-	LIMIT ?`
-
-	rows, err := db.Query(query, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query leaderboard: %v", err)
+	var accountID interface{}
+	if entry.AccountID != 0 {
+		accountID = entry.AccountID
 	}
-	defer rows.Close()
 
-	var entries []LeaderboardEntry
-	for rows.Next() {
-		var entry LeaderboardEntry
-		err := rows.Scan(
-			&entry.Username,
-			&entry.Score,
-			&entry.Date,
-			&entry.Duration,
-			&entry.GuessCount,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan leaderboard entry: %v", err)
-		}
-		entries = append(entries, entry)
+	var runID, playerID, ip interface{}
+	if entry.RunID != "" {
+		runID = entry.RunID
 	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating leaderboard rows: %v", err)
+	if entry.PlayerID != "" {
+		playerID = entry.PlayerID
 	}
-
-	return entries, nil
-}
-
-func AddLeaderboardEntryByDifficulty(entry LeaderboardEntry, difficulty string) error {
-
-	validDifficulties := map[string]bool{
-		"facile":    true,
-		"moyen":     true,
-		"difficile": true,
+	if entry.IP != "" {
+		ip = entry.IP
 	}
 
-	if !validDifficulties[difficulty] {
-		return fmt.Errorf("invalid difficulty: %s", difficulty)
+	_, err := s.exec(query, difficulty, mode, entry.Username, entry.Score, entry.Date.UTC(), entry.Duration, entry.GuessCount, runID, accountID, playerID, ip, entry.Hidden, entry.Suspicion, entry.Flags)
+	if entry.RunID != "" && isUniqueViolation(err) {
+		return ErrRunAlreadySubmitted
 	}
-
-	query := fmt.Sprintf(`
-	INSERT INTO leaderboard_%s (username, score, date, duration, guess_count)
-	VALUES (?, ?, ?, ?, ?)`, difficulty)
-
-	_, err := db.Exec(query, entry.Username, entry.Score, entry.Date, entry.Duration, entry.GuessCount)
 	if err != nil {
-		return fmt.Errorf("failed to add leaderboard_%s entry: %v", difficulty, err)
+		return fmt.Errorf("failed to add %s leaderboard entry: %v", difficulty, err)
 	}
 
 	return nil
@@ -177,10 +95,10 @@ func AddToLeaderboardByDifficulty(username string, score int, difficulty string)
 		GuessCount: 0,
 	}
 
-	return AddLeaderboardEntryByDifficulty(entry, difficulty)
+	return store.AddLeaderboardEntryByDifficulty(entry, difficulty)
 }
 
-func SubmitScoreByDifficulty(username string, session *GameSession, difficulty string) error {
+func SubmitScoreByDifficulty(username string, session *GameSession, difficulty string, accountID int64, ip string) error {
 	if username == "" {
 		return fmt.Errorf("username cannot be empty")
 	}
@@ -198,7 +116,7 @@ func SubmitScoreByDifficulty(username string, session *GameSession, difficulty s
 		totalDuration = int(time.Since(session.StartTime).Seconds())
 	}
 
-	totalGuesses = len(session.Guesses)
+	totalGuesses = session.GetTotalGuessCount()
 
 	entry := LeaderboardEntry{
 		Username:   SanitizeInput(username),
@@ -206,32 +124,66 @@ func SubmitScoreByDifficulty(username string, session *GameSession, difficulty s
 		Date:       time.Now(),
 		Duration:   totalDuration,
 		GuessCount: totalGuesses,
+		RunID:      session.RunID,
+		AccountID:  accountID,
+		PlayerID:   session.PlayerID,
+		IP:         ip,
 	}
 
-	return AddLeaderboardEntryByDifficulty(entry, difficulty)
-}
-
-func GetLeaderboardByDifficulty(limit int, difficulty string) ([]LeaderboardEntry, error) {
-
-	validDifficulties := map[string]bool{
-		"facile":    true,
-		"moyen":     true,
-		"difficile": true,
+	// Runs that look automated stay off the rankings until a moderator reviews them
+	if session.Analysis != nil {
+		entry.Suspicion = session.Analysis.Suspicion
+		entry.Flags = strings.Join(session.Analysis.Flags, ",")
+		entry.Hidden = session.Analysis.Flagged()
 	}
 
-	if !validDifficulties[difficulty] {
-		return nil, fmt.Errorf("invalid difficulty: %s", difficulty)
-	}
+	return store.AddLeaderboardEntryByDifficulty(entry, difficulty)
+}
 
-	query := fmt.Sprintf(`
-	SELECT username, score, date, duration, guess_count
-	FROM leaderboard_%s
-	ORDER BY score DESC, duration ASC
-	LIMIT ?`, difficulty)
+func GetLeaderboardByDifficulty(limit int, difficulty string, window LeaderboardWindow, view LeaderboardView) ([]LeaderboardEntry, error) {
+	return store.GetLeaderboardPageByDifficulty(difficulty, window, view, 0, limit)
+}
+
+// rankedLeaderboardQuery selects a leaderboard view as rows numbered by position.
+func rankedLeaderboardQuery(difficulty string, window LeaderboardWindow, view LeaderboardView) (string, []interface{}, error) {
+	if !slices.Contains(leaderboardDifficulties, difficulty) {
+		return "", nil, fmt.Errorf("invalid difficulty: %s", difficulty)
+	}
+
+	condition, windowArgs := windowCondition(window)
+	args := append([]interface{}{difficulty, GameModeClassic}, windowArgs...)
+
+	if view == ViewBest {
+		// Keep each username's best run, ranked the same way as the raw view
+		return fmt.Sprintf(`
+		SELECT username, score, date, duration, guess_count, run_id, account_id, run_count,
+			ROW_NUMBER() OVER (ORDER BY score DESC, duration ASC, id ASC) AS position
+		FROM (
+			SELECT id, username, score, date, duration, guess_count,
+				COALESCE(run_id, '') AS run_id,
+				COALESCE(account_id, 0) AS account_id,
+				ROW_NUMBER() OVER (PARTITION BY lower(username) ORDER BY score DESC, duration ASC, id ASC) AS user_rank,
+				COUNT(*) OVER (PARTITION BY lower(username)) AS run_count
+			FROM leaderboard_entries
+			WHERE difficulty = ? AND mode = ? AND NOT hidden AND %s
+		) AS user_entries
+		WHERE user_rank = 1`, condition), args, nil
+	}
+
+	return fmt.Sprintf(`
+	SELECT username, score, date, duration, guess_count,
+		COALESCE(run_id, '') AS run_id,
+		COALESCE(account_id, 0) AS account_id,
+		0 AS run_count,
+		ROW_NUMBER() OVER (ORDER BY score DESC, duration ASC, id ASC) AS position
+	FROM leaderboard_entries
+	WHERE difficulty = ? AND mode = ? AND NOT hidden AND %s`, condition), args, nil
+}
 
-	rows, err := db.Query(query, limit)
+func (s *sqlStore) queryRankedLeaderboard(query string, args ...interface{}) ([]LeaderboardEntry, error) {
+	rows, err := s.query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query leaderboard_%s: %v", difficulty, err)
+		return nil, fmt.Errorf("failed to query leaderboard: %v", err)
 	}
 	defer rows.Close()
 
@@ -244,20 +196,92 @@ func GetLeaderboardByDifficulty(limit int, difficulty string) ([]LeaderboardEntr
 			&entry.Date,
 			&entry.Duration,
 			&entry.GuessCount,
+			&entry.RunID,
+			&entry.AccountID,
+			&entry.RunCount,
+			&entry.Rank,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan leaderboard_%s row: %v", difficulty, err)
+			return nil, fmt.Errorf("failed to scan leaderboard row: %v", err)
 		}
 		entries = append(entries, entry)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating leaderboard_%s rows: %v", difficulty, err)
+		return nil, fmt.Errorf("error iterating leaderboard rows: %v", err)
 	}
 
 	return entries, nil
 }
 
+func (s *sqlStore) GetLeaderboardPageByDifficulty(difficulty string, window LeaderboardWindow, view LeaderboardView, offset, limit int) ([]LeaderboardEntry, error) {
+	defer observeLeaderboardQuery("page", time.Now())
+
+	ranked, args, err := rankedLeaderboardQuery(difficulty, window, view)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+	SELECT * FROM (%s) AS ranked
+	WHERE position > ?
+	ORDER BY position
+	LIMIT ?`, ranked)
+
+	return s.queryRankedLeaderboard(query, append(args, offset, limit)...)
+}
+
+func (s *sqlStore) CountLeaderboardByDifficulty(difficulty string, window LeaderboardWindow, view LeaderboardView) (int, error) {
+	defer observeLeaderboardQuery("count", time.Now())
+
+	ranked, args, err := rankedLeaderboardQuery(difficulty, window, view)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = s.queryRow(fmt.Sprintf(`SELECT COUNT(*) FROM (%s) AS ranked`, ranked), args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s leaderboard: %v", difficulty, err)
+	}
+
+	return count, nil
+}
+
+// GetLeaderboardAroundRun returns up to radius entries either side of a run's position, and that position.
+// In the best view the position is that of the run owner's best entry.
+// A zero position means the run is not on this leaderboard.
+func (s *sqlStore) GetLeaderboardAroundRun(difficulty string, window LeaderboardWindow, view LeaderboardView, runID string, radius int) ([]LeaderboardEntry, int, error) {
+	defer observeLeaderboardQuery("around", time.Now())
+
+	ranked, args, err := rankedLeaderboardQuery(difficulty, window, view)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	match := "run_id = ?"
+	if view == ViewBest {
+		match = "lower(username) = (SELECT lower(username) FROM leaderboard_entries WHERE run_id = ? LIMIT 1)"
+	}
+
+	var position int
+	err = s.queryRow(`SELECT position FROM (`+ranked+`) AS ranked WHERE `+match, append(args, runID)...).Scan(&position)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to locate run %s in %s leaderboard: %v", runID, difficulty, err)
+	}
+
+	query := fmt.Sprintf(`
+	SELECT * FROM (%s) AS ranked
+	WHERE position BETWEEN ? AND ?
+	ORDER BY position`, ranked)
+
+	entries, err := s.queryRankedLeaderboard(query, append(args, position-radius, position+radius)...)
+	return entries, position, err
+}
+
 type FormattedLeaderboardEntry struct {
 	Rank              int    `json:"rank"`
 	Username          string `json:"username"`
@@ -265,51 +289,63 @@ type FormattedLeaderboardEntry struct {
 	FormattedDate     string `json:"formatted_date"`
 	FormattedDuration string `json:"formatted_duration"`
 	GuessCount        int    `json:"guess_count"`
+	RunID             string `json:"run_id,omitempty"`
+	Verified          bool   `json:"verified"`
+	RunCount          int    `json:"run_count,omitempty"`
 }
 
-func GetFormattedLeaderboard(limit int) ([]FormattedLeaderboardEntry, error) {
-	entries, err := GetLeaderboard(limit)
+func GetFormattedLeaderboardByDifficulty(limit int, difficulty string, window LeaderboardWindow, view LeaderboardView) ([]FormattedLeaderboardEntry, error) {
+	entries, err := GetLeaderboardByDifficulty(limit, difficulty, window, view)
 	if err != nil {
 		return nil, err
 	}
 
+	return FormatLeaderboardEntries(entries), nil
+}
+
+func FormatLeaderboardEntries(entries []LeaderboardEntry) []FormattedLeaderboardEntry {
 	formatted := make([]FormattedLeaderboardEntry, len(entries))
 	for i, entry := range entries {
 		formatted[i] = FormattedLeaderboardEntry{
-			Rank:              i + 1,
+			Rank:              entry.Rank,
 			Username:          entry.Username,
 			Score:             entry.Score,
 			FormattedDate:     entry.Date.Format("Jan 2, 2006"),
 			FormattedDuration: FormatDuration(entry.Duration),
 			GuessCount:        entry.GuessCount,
+			RunID:             entry.RunID,
+			Verified:          entry.AccountID != 0,
+			RunCount:          entry.RunCount,
 		}
 	}
 
-	return formatted, nil
+	return formatted
 }
 
-func GetFormattedLeaderboardByDifficulty(limit int, difficulty string) ([]FormattedLeaderboardEntry, error) {
-	entries, err := GetLeaderboardByDifficulty(limit, difficulty)
-	if err != nil {
-		return nil, err
+// windowCondition bounds leaderboard dates to a window. SQLite compares dates as the text they were
+// written in, so they are always written and compared in UTC.
+func windowCondition(window LeaderboardWindow) (string, []interface{}) {
+	since, bounded := window.Since(time.Now())
+	if !bounded {
+		return "1 = 1", nil
 	}
+	return "date >= ?", []interface{}{since.UTC()}
+}
 
-	formatted := make([]FormattedLeaderboardEntry, len(entries))
-	for i, entry := range entries {
-		formatted[i] = FormattedLeaderboardEntry{
-			Rank:              i + 1,
-			Username:          entry.Username,
-			Score:             entry.Score,
-			FormattedDate:     entry.Date.Format("Jan 2, 2006"),
-			FormattedDuration: FormatDuration(entry.Duration),
-			GuessCount:        entry.GuessCount,
+func GetPlayerRanksByDifficulty(score int, duration int, difficulty string) (map[LeaderboardWindow]int, error) {
+	ranks := make(map[LeaderboardWindow]int, len(leaderboardWindows))
+	for _, window := range leaderboardWindows {
+		rank, err := store.GetPlayerRankByDifficulty(score, duration, difficulty, window)
+		if err != nil {
+			return nil, err
 		}
+		ranks[window] = rank
 	}
-
-	return formatted, nil
+	return ranks, nil
 }
 
-func GetPlayerRankByDifficulty(score int, duration int, difficulty string) (int, error) {
+func (s *sqlStore) GetPlayerRankByDifficulty(score int, duration int, difficulty string, window LeaderboardWindow) (int, error) {
+	defer observeLeaderboardQuery("rank", time.Now())
 
 	validDifficulties := map[string]bool{
 		"facile":    true,
@@ -321,16 +357,606 @@ func GetPlayerRankByDifficulty(score int, duration int, difficulty string) (int,
 		return 0, fmt.Errorf("invalid difficulty: %s", difficulty)
 	}
 
+	condition, args := windowCondition(window)
+
 	query := fmt.Sprintf(`
 	SELECT COUNT(*) + 1 as rank
-	FROM leaderboard_%s
-	WHERE score > ? OR (score = ? AND duration < ?)`, difficulty)
+	FROM leaderboard_entries
+	WHERE difficulty = ? AND mode = ? AND NOT hidden AND (score > ? OR (score = ? AND duration < ?)) AND %s`, condition)
 
 	var rank int
-	err := db.QueryRow(query, score, score, duration).Scan(&rank)
+	err := s.queryRow(query, append([]interface{}{difficulty, GameModeClassic, score, score, duration}, args...)...).Scan(&rank)
 	if err != nil {
 		return 0, fmt.Errorf("failed to calculate rank for difficulty %s: %v", difficulty, err)
 	}
 
 	return rank, nil
 }
+
+// LeaderboardFilter selects the entries to export. Hidden entries, those awaiting review included,
+// are exported unless VisibleOnly is set.
+type LeaderboardFilter struct {
+	Difficulty  string
+	From        time.Time
+	To          time.Time
+	VisibleOnly bool
+}
+
+func (s *sqlStore) ExportLeaderboardEntries(filter LeaderboardFilter) ([]LeaderboardEntry, error) {
+	query := `
+	SELECT difficulty, mode, username, score, date, duration, guess_count, COALESCE(run_id, ''),
+		hidden, suspicion, suspicion_flags
+	FROM leaderboard_entries
+	WHERE 1 = 1`
+
+	var args []interface{}
+	if filter.VisibleOnly {
+		query += ` AND NOT hidden`
+	}
+	if filter.Difficulty != "" {
+		query += ` AND difficulty = ?`
+		args = append(args, filter.Difficulty)
+	}
+	if !filter.From.IsZero() {
+		query += ` AND date >= ?`
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		query += ` AND date < ?`
+		args = append(args, filter.To.UTC())
+	}
+	query += ` ORDER BY date ASC, id ASC`
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query leaderboard entries: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		err := rows.Scan(
+			&entry.Difficulty,
+			&entry.Mode,
+			&entry.Username,
+			&entry.Score,
+			&entry.Date,
+			&entry.Duration,
+			&entry.GuessCount,
+			&entry.RunID,
+			&entry.Hidden,
+			&entry.Suspicion,
+			&entry.Flags,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating leaderboard entries: %v", err)
+	}
+
+	return entries, nil
+}
+
+// ImportLeaderboardEntries adds entries not already present and returns how many were added. An entry
+// is present when its run is already on the leaderboard, or when an entry has the same difficulty,
+// username, score and date. Hidden state and suspicion carry over, so the moderation queue moves
+// with the entries. Account links are not carried across environments, and run links only when
+// the run exists here. The import is recorded in the moderation log once any entry is added.
+func (s *sqlStore) ImportLeaderboardEntries(entries []LeaderboardEntry, action ModerationAction) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin import: %v", err)
+	}
+	defer tx.Rollback()
+
+	runQuery := s.rebind(`SELECT COUNT(*) FROM leaderboard_entries WHERE run_id = ?`)
+
+	existsQuery := s.rebind(`
+	SELECT date
+	FROM leaderboard_entries
+	WHERE difficulty = ? AND username = ? AND score = ?`)
+
+	insertQuery := s.rebind(`
+	INSERT INTO leaderboard_entries (difficulty, mode, username, score, date, duration, guess_count, run_id, hidden, suspicion, suspicion_flags)
+	VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT id FROM runs WHERE id = ?), ?, ?, ?)`)
+
+	imported := 0
+	for _, entry := range entries {
+		duplicate, err := func() (bool, error) {
+			if entry.RunID != "" {
+				var count int
+				if err := tx.QueryRow(runQuery, entry.RunID).Scan(&count); err != nil || count > 0 {
+					return count > 0, err
+				}
+			}
+
+			rows, err := tx.Query(existsQuery, entry.Difficulty, entry.Username, entry.Score)
+			if err != nil {
+				return false, err
+			}
+			defer rows.Close()
+
+			// Dates are compared in Go since their stored text form differs between backends,
+			// and to the microsecond since PostgreSQL keeps no finer precision.
+			for rows.Next() {
+				var date time.Time
+				if err := rows.Scan(&date); err != nil {
+					return false, err
+				}
+				if date.Truncate(time.Microsecond).Equal(entry.Date.Truncate(time.Microsecond)) {
+					return true, nil
+				}
+			}
+			return false, rows.Err()
+		}()
+		if err != nil {
+			return 0, fmt.Errorf("failed to check for duplicate entry: %v", err)
+		}
+		if duplicate {
+			continue
+		}
+
+		mode := entry.Mode
+		if mode == "" {
+			mode = GameModeClassic
+		}
+
+		_, err = tx.Exec(insertQuery, entry.Difficulty, mode, entry.Username, entry.Score, entry.Date.UTC(), entry.Duration, entry.GuessCount, entry.RunID, entry.Hidden, entry.Suspicion, entry.Flags)
+		if err != nil {
+			return 0, fmt.Errorf("failed to import entry for %s: %v", entry.Username, err)
+		}
+		imported++
+	}
+
+	if imported > 0 {
+		action.Details = fmt.Sprintf("%d of %d entries", imported, len(entries))
+		if err := s.recordModeration(tx, action); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit import: %v", err)
+	}
+
+	return imported, nil
+}
+
+func (s *sqlStore) AddTargetResult(result TargetResult) error {
+	guesses, err := json.Marshal(result.Guesses)
+	if err != nil {
+		return fmt.Errorf("failed to encode target guesses: %v", err)
+	}
+
+	query := `
+	INSERT INTO target_results (session_id, difficulty, player_id, found, guesses, start_time, end_time)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = s.exec(query, result.SessionID, result.Difficulty, result.PlayerID, result.Found, string(guesses), result.StartTime, result.EndTime)
+	if err != nil {
+		return fmt.Errorf("failed to add target result: %v", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) GetTargetResults(playerID string) ([]TargetResult, error) {
+	query := `
+	SELECT session_id, difficulty, player_id, found, guesses, start_time, end_time
+	FROM target_results`
+
+	var args []interface{}
+	if playerID != "" {
+		query += ` WHERE player_id = ?`
+		args = append(args, playerID)
+	}
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query target_results: %v", err)
+	}
+	defer rows.Close()
+
+	var results []TargetResult
+	for rows.Next() {
+		var result TargetResult
+		var guesses string
+		err := rows.Scan(
+			&result.SessionID,
+			&result.Difficulty,
+			&result.PlayerID,
+			&result.Found,
+			&guesses,
+			&result.StartTime,
+			&result.EndTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan target_results row: %v", err)
+		}
+
+		if err := json.Unmarshal([]byte(guesses), &result.Guesses); err != nil {
+			return nil, fmt.Errorf("failed to decode target guesses: %v", err)
+		}
+
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating target_results rows: %v", err)
+	}
+
+	return results, nil
+}
+
+func (s *sqlStore) SaveRun(run Run) error {
+	lineup, err := json.Marshal(run.Lineup)
+	if err != nil {
+		return fmt.Errorf("failed to encode run lineup: %v", err)
+	}
+
+	targets, err := json.Marshal(run.Targets)
+	if err != nil {
+		return fmt.Errorf("failed to encode run targets: %v", err)
+	}
+
+	query := `
+	INSERT INTO runs (id, difficulty, score, start_time, end_time, players_found, lineup, targets, player_id, account_id, transcript, hidden)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var accountID interface{}
+	if run.AccountID != 0 {
+		accountID = run.AccountID
+	}
+
+	_, err = s.exec(query, run.ID, run.Difficulty, run.Score, run.StartTime, run.EndTime, run.PlayersFound, string(lineup), string(targets), run.PlayerID, accountID, string(run.Transcript), run.Hidden)
+	if err != nil {
+		return fmt.Errorf("failed to save run %s: %v", run.ID, err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) SetRunOwner(runID, username string, accountID int64) error {
+	query := `
+	UPDATE runs
+	SET username = ?, account_id = COALESCE(?, account_id)
+	WHERE id = ?`
+
+	var account interface{}
+	if accountID != 0 {
+		account = accountID
+	}
+
+	if _, err := s.exec(query, username, account, runID); err != nil {
+		return fmt.Errorf("failed to set owner of run %s: %v", runID, err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) LinkPlayerRunsToAccount(playerID string, accountID int64) error {
+	query := `
+	UPDATE runs
+	SET account_id = ?
+	WHERE player_id = ? AND account_id IS NULL`
+
+	if _, err := s.exec(query, accountID, playerID); err != nil {
+		return fmt.Errorf("failed to link runs to account %d: %v", accountID, err)
+	}
+
+	return nil
+}
+
+const runColumns = `id, difficulty, score, start_time, end_time, players_found, lineup, targets,
+	COALESCE(player_id, ''), COALESCE(username, ''), COALESCE(account_id, 0), transcript <> '', hidden`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row rowScanner) (*Run, error) {
+	var run Run
+	var lineup, targets string
+	err := row.Scan(
+		&run.ID,
+		&run.Difficulty,
+		&run.Score,
+		&run.StartTime,
+		&run.EndTime,
+		&run.PlayersFound,
+		&lineup,
+		&targets,
+		&run.PlayerID,
+		&run.Username,
+		&run.AccountID,
+		&run.HasTranscript,
+		&run.Hidden,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(lineup), &run.Lineup); err != nil {
+		return nil, fmt.Errorf("failed to decode run lineup: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(targets), &run.Targets); err != nil {
+		return nil, fmt.Errorf("failed to decode run targets: %v", err)
+	}
+
+	return &run, nil
+}
+
+func (s *sqlStore) GetRun(runID string) (*Run, error) {
+	query := `SELECT ` + runColumns + ` FROM runs WHERE id = ?`
+
+	run, err := scanRun(s.queryRow(query, runID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query run %s: %v", runID, err)
+	}
+
+	return run, nil
+}
+
+// GetRunTranscript returns the signed transcript of a run, or nil if the run has none.
+func (s *sqlStore) GetRunTranscript(runID string) ([]byte, error) {
+	var transcript string
+	err := s.queryRow(`SELECT transcript FROM runs WHERE id = ?`, runID).Scan(&transcript)
+	if err == sql.ErrNoRows || (err == nil && transcript == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transcript of run %s: %v", runID, err)
+	}
+
+	return []byte(transcript), nil
+}
+
+// queryRuns lists the runs profiles are built from, leaving out hidden ones: runs the anticheat
+// flagged, or whose leaderboard entry a moderator hid or deleted.
+func (s *sqlStore) queryRuns(condition string, args ...interface{}) ([]Run, error) {
+	query := `SELECT ` + runColumns + ` FROM runs WHERE NOT hidden AND ` + condition + ` ORDER BY end_time ASC`
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs: %v", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan run: %v", err)
+		}
+		runs = append(runs, *run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating runs rows: %v", err)
+	}
+
+	return runs, nil
+}
+
+func (s *sqlStore) GetRunsByAccount(accountID int64) ([]Run, error) {
+	return s.queryRuns(`account_id = ?`, accountID)
+}
+
+func (s *sqlStore) GetRunsByUsername(username string) ([]Run, error) {
+	return s.queryRuns(`lower(username) = lower(?) AND account_id IS NULL`, username)
+}
+
+func (s *sqlStore) GetRunsByPlayerID(playerID string) ([]Run, error) {
+	return s.queryRuns(`player_id = ?`, playerID)
+}
+
+func (s *sqlStore) CreateAccount(username, passwordHash string) (*Account, error) {
+	query := `
+	INSERT INTO accounts (username, folded_username, password_hash, created_at)
+	VALUES (?, ?, ?, ?)
+	RETURNING id`
+
+	var folded interface{}
+	if f := foldUsername(username); f != "" {
+		folded = f
+	}
+
+	now := time.Now()
+	var id int64
+	err := s.queryRow(query, username, folded, passwordHash, now).Scan(&id)
+	if isUniqueViolation(err) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account: %v", err)
+	}
+
+	return &Account{ID: id, Username: username, PasswordHash: passwordHash, Role: AccountRolePlayer, CreatedAt: now}, nil
+}
+
+func scanAccount(row *sql.Row) (*Account, error) {
+	var account Account
+	err := row.Scan(&account.ID, &account.Username, &account.PasswordHash, &account.Role, &account.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (s *sqlStore) GetAccountByUsername(username string) (*Account, error) {
+	query := `
+	SELECT id, username, password_hash, role, created_at
+	FROM accounts
+	WHERE lower(username) = lower(?)`
+
+	account, err := scanAccount(s.queryRow(query, username))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account %s: %v", username, err)
+	}
+
+	return account, nil
+}
+
+// GetAccountByFoldedUsername returns the account whose name folds to the same as username, so
+// "B0bby" or "B o b b y" finds Bobby's account.
+func (s *sqlStore) GetAccountByFoldedUsername(username string) (*Account, error) {
+	folded := foldUsername(username)
+	if folded == "" {
+		return nil, nil
+	}
+
+	query := `
+	SELECT id, username, password_hash, role, created_at
+	FROM accounts
+	WHERE folded_username = ?`
+
+	account, err := scanAccount(s.queryRow(query, folded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account folding to %s: %v", folded, err)
+	}
+
+	return account, nil
+}
+
+// hashAuthToken is what auth_sessions stores in place of the token, so a leaked table
+// does not hand out logged-in sessions. Tokens are random, so a plain SHA-256 is enough.
+func hashAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *sqlStore) CreateAuthSession(token string, accountID int64, expiresAt time.Time) error {
+	query := `
+	INSERT INTO auth_sessions (token, account_id, expires_at)
+	VALUES (?, ?, ?)`
+
+	if _, err := s.exec(query, hashAuthToken(token), accountID, expiresAt); err != nil {
+		return fmt.Errorf("failed to create auth session: %v", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) GetAccountByAuthToken(token string) (*Account, error) {
+	query := `
+	SELECT a.id, a.username, a.password_hash, a.role, a.created_at
+	FROM auth_sessions s
+	JOIN accounts a ON a.id = s.account_id
+	WHERE s.token = ? AND s.expires_at > ?`
+
+	account, err := scanAccount(s.queryRow(query, hashAuthToken(token), time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query auth session: %v", err)
+	}
+
+	return account, nil
+}
+
+func (s *sqlStore) DeleteAuthSession(token string) error {
+	if _, err := s.exec(`DELETE FROM auth_sessions WHERE token = ?`, hashAuthToken(token)); err != nil {
+		return fmt.Errorf("failed to delete auth session: %v", err)
+	}
+
+	return nil
+}
+
+// savedSession carries the session fields the JSON encoding of GameSession leaves out.
+type savedSession struct {
+	*GameSession
+	PlayerID          string       `json:"player_id,omitempty"`
+	AccountID         int64        `json:"account_id,omitempty"`
+	AutocompleteTimes []time.Time  `json:"autocomplete_times,omitempty"`
+	Analysis          *RunAnalysis `json:"analysis,omitempty"`
+}
+
+// SaveSessions replaces the saved sessions with the given ones, so they outlive a restart.
+func (s *sqlStore) SaveSessions(sessions []*GameSession) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin saving sessions: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM saved_sessions`); err != nil {
+		return fmt.Errorf("failed to clear saved sessions: %v", err)
+	}
+
+	query := s.rebind(`INSERT INTO saved_sessions (id, data, saved_at) VALUES (?, ?, ?)`)
+	now := time.Now()
+	for _, session := range sessions {
+		data, err := json.Marshal(savedSession{
+			GameSession:       session,
+			PlayerID:          session.PlayerID,
+			AccountID:         session.AccountID,
+			AutocompleteTimes: session.AutocompleteTimes,
+			Analysis:          session.Analysis,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode session: %v", err)
+		}
+
+		if _, err := tx.Exec(query, session.SessionID, string(data), now); err != nil {
+			return fmt.Errorf("failed to save session: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// TakeSavedSessions returns the saved sessions and removes them, so each is restored once.
+func (s *sqlStore) TakeSavedSessions() ([]*GameSession, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin loading sessions: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT data FROM saved_sessions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query saved sessions: %v", err)
+	}
+	defer rows.Close()
+
+	var sessions []*GameSession
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan saved session: %v", err)
+		}
+
+		saved := savedSession{GameSession: &GameSession{}}
+		if err := json.Unmarshal([]byte(data), &saved); err != nil {
+			return nil, fmt.Errorf("failed to decode saved session: %v", err)
+		}
+
+		session := saved.GameSession
+		session.PlayerID = saved.PlayerID
+		session.AccountID = saved.AccountID
+		session.AutocompleteTimes = saved.AutocompleteTimes
+		session.Analysis = saved.Analysis
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating saved sessions: %v", err)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(`DELETE FROM saved_sessions`); err != nil {
+		return nil, fmt.Errorf("failed to clear saved sessions: %v", err)
+	}
+
+	return sessions, tx.Commit()
+}
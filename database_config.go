@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Databases created before the path was configurable live here, relative to the working directory.
+const legacyDatabasePath = "./prodle.db"
+
+var sqliteJournalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+type DatabaseConfig struct {
+	URL         string
+	Path        string
+	JournalMode string
+	BusyTimeout time.Duration
+	ForeignKeys bool
+}
+
+// LoadDatabaseConfig reads the database settings from the environment:
+// a postgres:// DATABASE_URL selects PostgreSQL, a sqlite:// or file: one names the SQLite file,
+// and without one DATABASE_PATH does. SQLite is tuned by SQLITE_JOURNAL_MODE,
+// SQLITE_BUSY_TIMEOUT_MS and SQLITE_FOREIGN_KEYS.
+func LoadDatabaseConfig() (DatabaseConfig, error) {
+	config := DatabaseConfig{
+		URL:         os.Getenv("DATABASE_URL"),
+		Path:        os.Getenv("DATABASE_PATH"),
+		JournalMode: strings.ToUpper(os.Getenv("SQLITE_JOURNAL_MODE")),
+		BusyTimeout: 5 * time.Second,
+		ForeignKeys: true,
+	}
+
+	if config.URL != "" && !config.IsPostgres() {
+		path, err := sqlitePathFromURL(config.URL)
+		if err != nil {
+			return config, err
+		}
+		config.Path = path
+	}
+
+	if config.Path == "" {
+		config.Path = legacyDatabasePath
+	}
+
+	if config.JournalMode == "" {
+		config.JournalMode = "WAL"
+	}
+
+	valid := false
+	for _, mode := range sqliteJournalModes {
+		if config.JournalMode == mode {
+			valid = true
+		}
+	}
+	if !valid {
+		return config, fmt.Errorf("invalid SQLITE_JOURNAL_MODE %q", config.JournalMode)
+	}
+
+	if value := os.Getenv("SQLITE_BUSY_TIMEOUT_MS"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms < 0 {
+			return config, fmt.Errorf("invalid SQLITE_BUSY_TIMEOUT_MS %q", value)
+		}
+		config.BusyTimeout = time.Duration(ms) * time.Millisecond
+	}
+
+	if value := os.Getenv("SQLITE_FOREIGN_KEYS"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid SQLITE_FOREIGN_KEYS %q", value)
+		}
+		config.ForeignKeys = enabled
+	}
+
+	return config, nil
+}
+
+func (c DatabaseConfig) IsPostgres() bool {
+	return strings.HasPrefix(c.URL, "postgres://") || strings.HasPrefix(c.URL, "postgresql://")
+}
+
+// sqlitePathFromURL returns the file a sqlite:// or file: DATABASE_URL names. Any other scheme is
+// rejected, so that a typo does not start the server on a new, empty SQLite file.
+func sqlitePathFromURL(databaseURL string) (string, error) {
+	var path string
+	switch {
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		path = strings.TrimPrefix(databaseURL, "sqlite://")
+	case strings.HasPrefix(databaseURL, "file:"):
+		path = strings.TrimPrefix(databaseURL, "file:")
+		// file:///data/prodle.db has an empty authority before the absolute path
+		if strings.HasPrefix(path, "///") {
+			path = strings.TrimPrefix(path, "//")
+		}
+	default:
+		scheme, _, _ := strings.Cut(databaseURL, ":")
+		return "", fmt.Errorf("unsupported DATABASE_URL scheme %q, use postgres://, sqlite:// or file:", scheme)
+	}
+
+	if path == "" {
+		return "", fmt.Errorf("DATABASE_URL %q names no SQLite file", databaseURL)
+	}
+	return path, nil
+}
+
+// SQLiteDSN builds the go-sqlite3 data source name, which applies the pragmas on every new connection.
+func (c DatabaseConfig) SQLiteDSN() string {
+	foreignKeys := "off"
+	if c.ForeignKeys {
+		foreignKeys = "on"
+	}
+
+	params := url.Values{}
+	params.Set("_journal_mode", c.JournalMode)
+	params.Set("_busy_timeout", strconv.FormatInt(c.BusyTimeout.Milliseconds(), 10))
+	params.Set("_foreign_keys", foreignKeys)
+
+	// SQLite decodes the file: URI, so a ? or # in the path must not end it early
+	path := (&url.URL{Path: c.Path}).EscapedPath()
+	return "file:" + path + "?" + params.Encode()
+}
+
+// relocateLegacyDatabase moves a ./prodle.db left behind by older versions to the configured path,
+// so that upgrading does not silently start an empty leaderboard.
+func relocateLegacyDatabase(path string) error {
+	legacyPath, err := filepath.Abs(legacyDatabasePath)
+	if err != nil {
+		return err
+	}
+
+	targetPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if legacyPath == targetPath {
+		return nil
+	}
+
+	if _, err := os.Stat(legacyPath); err != nil {
+		return nil
+	}
+
+	if _, err := os.Stat(targetPath); err == nil {
+		slog.Warn("Legacy database left in place, the configured database already exists", "legacy_path", legacyPath, "path", targetPath)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return fmt.Errorf("failed to create database directory: %v", err)
+	}
+
+	// The -wal file holds committed data not yet checkpointed into the main file.
+	// The main file goes last so that a move interrupted part way is retried on the next start.
+	for _, suffix := range []string{"-wal", "-shm", ""} {
+		if _, err := os.Stat(legacyPath + suffix); err != nil {
+			continue
+		}
+		if err := moveFile(legacyPath+suffix, targetPath+suffix); err != nil {
+			return fmt.Errorf("failed to move %s: %v", legacyPath+suffix, err)
+		}
+	}
+
+	slog.Info("Moved database", "from", legacyPath, "to", targetPath)
+	return nil
+}
+
+// moveFile renames src to dst, copying instead when they are on different filesystems, as with a Docker volume.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// copyFile writes src to a temporary file beside dst and renames it into place, so dst is never left half written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
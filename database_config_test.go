@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDatabaseConfigURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		wantPostgres bool
+		wantPath     string
+		wantErr      string
+	}{
+		{"unset", "", false, "/data/from-path.db", ""},
+		{"postgres", "postgres://prodle@db/prodle", true, "/data/from-path.db", ""},
+		{"postgresql", "postgresql://prodle@db/prodle", true, "/data/from-path.db", ""},
+		{"sqlite", "sqlite:///data/prodle.db", false, "/data/prodle.db", ""},
+		{"sqlite relative", "sqlite://db/prodle.db", false, "db/prodle.db", ""},
+		{"file", "file:/data/prodle.db", false, "/data/prodle.db", ""},
+		{"file with authority", "file:///data/prodle.db", false, "/data/prodle.db", ""},
+		{"typo", "postgress://prodle@db/prodle", false, "", `unsupported DATABASE_URL scheme "postgress"`},
+		{"other database", "mysql://prodle@db/prodle", false, "", `unsupported DATABASE_URL scheme "mysql"`},
+		{"bare path", "/data/prodle.db", false, "", "unsupported DATABASE_URL scheme"},
+		{"no file", "sqlite://", false, "", "names no SQLite file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", tt.url)
+			t.Setenv("DATABASE_PATH", "/data/from-path.db")
+
+			config, err := LoadDatabaseConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadDatabaseConfig: %v", err)
+			}
+			if config.IsPostgres() != tt.wantPostgres || config.Path != tt.wantPath {
+				t.Errorf("postgres = %v, path = %q, want %v, %q", config.IsPostgres(), config.Path, tt.wantPostgres, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestSQLiteDSNEscapesPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "odd?name#1 %41.db")
+	config := DatabaseConfig{Path: path, JournalMode: "WAL", ForeignKeys: true}
+
+	s, err := NewSQLiteStore(config.SQLiteDSN())
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	s.Close()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("database not created at %s: %v", path, err)
+	}
+}
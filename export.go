@@ -0,0 +1,454 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxImportSize = 32 << 20
+
+var exportColumns = []string{"difficulty", "mode", "username", "score", "date", "duration", "guess_count", "run_id", "hidden", "suspicion", "suspicion_flags"}
+
+type ImportResponse struct {
+	Success  bool   `json:"success"`
+	Message  string `json:"message,omitempty"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+}
+
+func validExportFormat(format string) bool {
+	return format == "csv" || format == "json"
+}
+
+// parseFilterDate accepts a day (YYYY-MM-DD) or an RFC 3339 timestamp. A day used as the
+// end of a range includes the whole day.
+func parseFilterDate(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if end {
+			return day.AddDate(0, 0, 1), nil
+		}
+		return day, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
+
+func ParseLeaderboardFilter(difficulty, from, to string) (LeaderboardFilter, error) {
+	var filter LeaderboardFilter
+
+	if difficulty != "" && difficulty != "all" {
+		if !slices.Contains(leaderboardDifficulties, difficulty) {
+			return filter, fmt.Errorf("invalid difficulty: %s", difficulty)
+		}
+		filter.Difficulty = difficulty
+	}
+
+	var err error
+	if filter.From, err = parseFilterDate(from, false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseFilterDate(to, true); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func WriteLeaderboardExport(w io.Writer, format string, entries []LeaderboardEntry) error {
+	if format == "json" {
+		if entries == nil {
+			entries = []LeaderboardEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		record := []string{
+			entry.Difficulty,
+			entry.Mode,
+			entry.Username,
+			strconv.Itoa(entry.Score),
+			entry.Date.Format(time.RFC3339Nano),
+			strconv.Itoa(entry.Duration),
+			strconv.Itoa(entry.GuessCount),
+			entry.RunID,
+			strconv.FormatBool(entry.Hidden),
+			strconv.Itoa(entry.Suspicion),
+			entry.Flags,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func ReadLeaderboardImport(r io.Reader, format string) ([]LeaderboardEntry, error) {
+	var entries []LeaderboardEntry
+
+	if format == "json" {
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+	} else {
+		var err error
+		entries, err = readLeaderboardCSV(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		entry.Username = SanitizeInput(entry.Username)
+		entry.AccountID = 0
+
+		if !slices.Contains(leaderboardDifficulties, entry.Difficulty) {
+			return nil, fmt.Errorf("entry %d: invalid difficulty %q", i+1, entry.Difficulty)
+		}
+		if entry.Mode != "" && entry.Mode != GameModeClassic && entry.Mode != GameModeLegacy {
+			return nil, fmt.Errorf("entry %d: invalid mode %q", i+1, entry.Mode)
+		}
+		if entry.Username == "" {
+			return nil, fmt.Errorf("entry %d: username cannot be empty", i+1)
+		}
+		if entry.Score < 0 || entry.Duration < 0 || entry.GuessCount < 0 || entry.Suspicion < 0 {
+			return nil, fmt.Errorf("entry %d: score, duration, guess count and suspicion cannot be negative", i+1)
+		}
+		if entry.Date.IsZero() {
+			return nil, fmt.Errorf("entry %d: date is required", i+1)
+		}
+	}
+
+	return entries, nil
+}
+
+// readLeaderboardCSV maps columns by header name, so spreadsheets may reorder or drop optional columns.
+func readLeaderboardCSV(r io.Reader) ([]LeaderboardEntry, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %v", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+
+	for _, required := range []string{"difficulty", "username", "score", "date"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV is missing the %s column", required)
+		}
+	}
+
+	var entries []LeaderboardEntry
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		number := func(name string) (int, error) {
+			value := field(name)
+			if value == "" {
+				return 0, nil
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid %s %q", line, name, value)
+			}
+			return n, nil
+		}
+
+		entry := LeaderboardEntry{
+			Difficulty: field("difficulty"),
+			Mode:       field("mode"),
+			Username:   field("username"),
+			RunID:      field("run_id"),
+			Flags:      field("suspicion_flags"),
+		}
+
+		if entry.Score, err = number("score"); err != nil {
+			return nil, err
+		}
+		if entry.Duration, err = number("duration"); err != nil {
+			return nil, err
+		}
+		if entry.GuessCount, err = number("guess_count"); err != nil {
+			return nil, err
+		}
+		if entry.Suspicion, err = number("suspicion"); err != nil {
+			return nil, err
+		}
+
+		if hidden := field("hidden"); hidden != "" {
+			if entry.Hidden, err = strconv.ParseBool(hidden); err != nil {
+				return nil, fmt.Errorf("line %d: invalid hidden %q", line, hidden)
+			}
+		}
+
+		if entry.Date, err = time.Parse(time.RFC3339Nano, field("date")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, field("date"))
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func runExportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "csv or json")
+	difficulty := flags.String("difficulty", "all", "facile, moyen, difficile or all")
+	from := flags.String("from", "", "first day to include (YYYY-MM-DD)")
+	to := flags.String("to", "", "last day to include (YYYY-MM-DD)")
+	visibleOnly := flags.Bool("visible-only", false, "leave out hidden entries, those awaiting review included")
+	output := flags.String("o", "", "output file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !validExportFormat(*format) {
+		return fmt.Errorf("invalid format %q, use csv or json", *format)
+	}
+
+	filter, err := ParseLeaderboardFilter(*difficulty, *from, *to)
+	if err != nil {
+		return err
+	}
+	filter.VisibleOnly = *visibleOnly
+
+	if err := InitDatabase(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entries, err := store.ExportLeaderboardEntries(filter)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return WriteLeaderboardExport(os.Stdout, *format, entries)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteLeaderboardExport(file, *format, entries); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	slog.Info("Exported leaderboard", "entries", len(entries), "path", *output)
+	return nil
+}
+
+func runImportCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "csv or json (default from the file extension)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: prodle import [-format csv|json] <file>")
+	}
+	path := flags.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if !validExportFormat(*format) {
+		return fmt.Errorf("invalid format %q, use csv or json", *format)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := ReadLeaderboardImport(file, *format)
+	if err != nil {
+		return err
+	}
+
+	if err := InitDatabase(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	action := ModerationAction{
+		Actor:  "cli",
+		Action: "import",
+		Target: "leaderboard " + filepath.Base(path),
+	}
+
+	imported, err := store.ImportLeaderboardEntries(entries, action)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Imported leaderboard", "imported", imported, "duplicates", len(entries)-imported)
+	return nil
+}
+
+func adminExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if !validExportFormat(format) {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := ParseLeaderboardFilter(query.Get("difficulty"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if value := query.Get("visible_only"); value != "" {
+		if filter.VisibleOnly, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid visible_only", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := store.ExportLeaderboardEntries(filter)
+	if err != nil {
+		http.Error(w, "Error exporting leaderboard", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error exporting leaderboard", "error", err)
+		return
+	}
+
+	contentType := "text/csv"
+	if format == "json" {
+		contentType = "application/json"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="prodle-leaderboard-%s.%s"`, time.Now().Format("20060102"), format))
+
+	if err := WriteLeaderboardExport(w, format, entries); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing leaderboard export", "error", err)
+	}
+}
+
+func adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			format = "json"
+		}
+	}
+	if !validExportFormat(format) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ImportResponse{Message: "Invalid format"})
+		return
+	}
+
+	entries, err := ReadLeaderboardImport(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ImportResponse{Message: err.Error()})
+		return
+	}
+
+	action := ModerationAction{
+		Actor:  actor,
+		Action: "import",
+		Target: "leaderboard",
+	}
+
+	imported, err := store.ImportLeaderboardEntries(entries, action)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error importing leaderboard", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ImportResponse{Message: "Failed to import leaderboard"})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Admin imported leaderboard", "actor", actor, "imported", imported, "duplicates", len(entries)-imported)
+
+	response := ImportResponse{
+		Success:  true,
+		Imported: imported,
+		Skipped:  len(entries) - imported,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLeaderboardImport(t *testing.T) {
+	header := "difficulty,mode,username,score,date\n"
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    int
+		wantErr string
+	}{
+		{"csv", "csv", header + "facile,classic,alice,5000,2025-03-14T15:09:26.535897932Z\nmoyen,,bob,4000,2025-03-14T15:09:27Z\n", 2, ""},
+		{"legacy mode", "csv", header + "facile,legacy,alice,5000,2025-03-14T15:09:26Z\n", 1, ""},
+		{"unknown mode", "csv", header + "facile,ranked,alice,5000,2025-03-14T15:09:26Z\n", 0, `invalid mode "ranked"`},
+		{"unknown json mode", "json", `[{"difficulty":"facile","mode":"Classic","username":"alice","score":1,"date":"2025-03-14T15:09:26Z"}]`, 0, `invalid mode "Classic"`},
+		{"unknown difficulty", "csv", header + "extreme,classic,alice,5000,2025-03-14T15:09:26Z\n", 0, `invalid difficulty "extreme"`},
+		{"missing date", "json", `[{"difficulty":"facile","username":"alice","score":1}]`, 0, "date is required"},
+		{"missing column", "csv", "difficulty,username,score\nfacile,alice,1\n", 0, "missing the date column"},
+		{"hidden entry", "csv", "difficulty,username,score,date,hidden,suspicion\nfacile,alice,1,2025-03-14T15:09:26Z,true,80\n", 1, ""},
+		{"invalid hidden", "csv", "difficulty,username,score,date,hidden\nfacile,alice,1,2025-03-14T15:09:26Z,maybe\n", 0, `invalid hidden "maybe"`},
+		{"negative suspicion", "json", `[{"difficulty":"facile","username":"alice","score":1,"date":"2025-03-14T15:09:26Z","suspicion":-1}]`, 0, "cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ReadLeaderboardImport(strings.NewReader(tt.input), tt.format)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadLeaderboardImport: %v", err)
+			}
+			if len(entries) != tt.want {
+				t.Errorf("read %d entries, want %d", len(entries), tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaderboardExportRoundTrip(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339Nano, "2025-03-14T15:09:26.535897Z")
+	entries := []LeaderboardEntry{
+		{Difficulty: "facile", Mode: GameModeClassic, Username: "alice", Score: 5000, Date: date, Duration: 90, GuessCount: 30, RunID: "run-1"},
+		{Difficulty: "moyen", Mode: GameModeClassic, Username: "mallory", Score: 9000, Date: date, Duration: 20, GuessCount: 20,
+			Hidden: true, Suspicion: 80, Flags: FlagSubSecondGuesses + "," + FlagUniformTiming},
+	}
+
+	for _, format := range []string{"csv", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteLeaderboardExport(&buf, format, entries); err != nil {
+				t.Fatalf("WriteLeaderboardExport: %v", err)
+			}
+
+			got, err := ReadLeaderboardImport(&buf, format)
+			if err != nil {
+				t.Fatalf("ReadLeaderboardImport: %v", err)
+			}
+			if len(got) != len(entries) {
+				t.Fatalf("read %d entries, want %d", len(got), len(entries))
+			}
+			for i := range entries {
+				if !got[i].Date.Equal(entries[i].Date) {
+					t.Errorf("entry %d date = %v, want %v", i, got[i].Date, entries[i].Date)
+				}
+				got[i].Date = entries[i].Date
+				if got[i] != entries[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], entries[i])
+				}
+			}
+		})
+	}
+}
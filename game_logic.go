@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
 )
@@ -14,10 +16,8 @@ var (
 	sessionMutex   sync.RWMutex
 )
 
-const (
-	PlayersPerSession = 20
-	TotalGameTime     = 120
-)
+// Sessions are saved across restarts for a day, long after any game or score submission is over.
+const maxSavedSessionAge = 24 * time.Hour
 
 func generateSessionID() (string, error) {
 	bytes := make([]byte, 16)
@@ -27,13 +27,22 @@ func generateSessionID() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func CreateNewSessionWithDifficulty(difficulty string) (*GameSession, error) {
+func generateRunID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func CreateNewSessionWithDifficulty(ctx context.Context, difficulty string, playerID string, accountID int64) (*GameSession, error) {
 	sessionID, err := generateSessionID()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate session ID: %v", err)
 	}
 
-	players, err := GetRandomPlayersByDifficulty(PlayersPerSession, difficulty)
+	settings := gameConfig.For(difficulty)
+	players, err := GetRandomPlayersByDifficulty(settings.PlayersPerSession, difficulty)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get random players for difficulty %s: %v", difficulty, err)
 	}
@@ -42,37 +51,92 @@ func CreateNewSessionWithDifficulty(difficulty string) (*GameSession, error) {
 	session := &GameSession{
 		SessionID:          sessionID,
 		Difficulty:         difficulty,
+		Settings:           settings,
 		SelectedPlayers:    players,
 		CurrentPlayerIndex: 0,
 		Score:              0,
 		StartTime:          now,
-		Guesses:            make([]GuessResult, 0),
+		Targets:            make([]TargetAttempt, 0, len(players)),
 		IsCompleted:        false,
 		CompletionTime:     nil,
+		PlayerID:           playerID,
+		AccountID:          accountID,
 	}
+	session.startTarget(now)
 
 	sessionMutex.Lock()
 	activeSessions[sessionID] = session
 	sessionMutex.Unlock()
+	sessionsStarted.WithLabelValues(difficulty).Inc()
 
-	log.Printf("Created new session %s with difficulty %s and %d players", sessionID, difficulty, len(players))
+	slog.InfoContext(ctx, "Created session", sessionAttr(sessionID), "difficulty", difficulty, "players", len(players))
 
 	return session, nil
 }
 
-func GetSession(sessionID string) (*GameSession, bool) {
+func GetSession(ctx context.Context, sessionID string) (*GameSession, bool) {
 	sessionMutex.RLock()
-	defer sessionMutex.RUnlock()
-
 	session, exists := activeSessions[sessionID]
+	sessionMutex.RUnlock()
 
 	if !exists {
-		log.Printf("Session %s not found. Active sessions: %d", sessionID, len(activeSessions))
+		slog.DebugContext(ctx, "Session not found", sessionAttr(sessionID))
 	}
 
 	return session, exists
 }
 
+// FlushSessions saves every session in memory, so that games and pending score submissions
+// survive a restart. Call it once no request can modify a session any more.
+func FlushSessions() error {
+	cutoff := time.Now().Add(-maxSavedSessionAge)
+
+	sessionMutex.RLock()
+	sessions := make([]*GameSession, 0, len(activeSessions))
+	for _, session := range activeSessions {
+		if session.StartTime.After(cutoff) {
+			sessions = append(sessions, session)
+		}
+	}
+	sessionMutex.RUnlock()
+
+	if err := store.SaveSessions(sessions); err != nil {
+		return err
+	}
+
+	slog.Info("Saved sessions", "sessions", len(sessions))
+	return nil
+}
+
+// RestoreSessions loads the sessions saved by the previous server, with their clocks still running.
+func RestoreSessions() error {
+	sessions, err := store.TakeSavedSessions()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-maxSavedSessionAge)
+	restored := 0
+
+	sessionMutex.Lock()
+	for _, session := range sessions {
+		if session.StartTime.After(cutoff) {
+			// Sessions saved before settings were kept per session were played with the defaults of the time.
+			if session.Settings.TotalGameTimeSeconds == 0 {
+				session.Settings = DefaultGameSettings
+			}
+			activeSessions[session.SessionID] = session
+			restored++
+		}
+	}
+	sessionMutex.Unlock()
+
+	if restored > 0 {
+		slog.Info("Restored sessions", "sessions", restored)
+	}
+	return nil
+}
+
 func UpdateSession(session *GameSession) {
 	sessionMutex.Lock()
 	defer sessionMutex.Unlock()
@@ -87,21 +151,52 @@ func (gs *GameSession) GetCurrentPlayer() *Player {
 	return nil
 }
 
-func (gs *GameSession) GetTotalElapsedTime() int {
-	return int(time.Since(gs.StartTime).Seconds())
+func (gs *GameSession) GetCurrentTarget() *TargetAttempt {
+	if gs.CurrentPlayerIndex >= 0 && gs.CurrentPlayerIndex < len(gs.Targets) {
+		return &gs.Targets[gs.CurrentPlayerIndex]
+	}
+	return nil
 }
 
-func (gs *GameSession) GetCurrentScore() int {
-	elapsedSeconds := gs.GetTotalElapsedTime()
-	totalWrongGuesses := 0
+func (gs *GameSession) GetTotalGuessCount() int {
+	total := 0
+	for _, target := range gs.Targets {
+		total += len(target.Guesses)
+	}
+	return total
+}
 
-	for _, guess := range gs.Guesses {
-		if !guess.IsCorrect {
-			totalWrongGuesses++
-		}
+func (gs *GameSession) startTarget(now time.Time) {
+	player := gs.GetCurrentPlayer()
+	if player == nil {
+		return
+	}
+
+	gs.Targets = append(gs.Targets, TargetAttempt{
+		PlayerID:  player.ID,
+		Guesses:   make([]GuessResult, 0),
+		StartTime: now,
+		Outcome:   TargetPending,
+	})
+}
+
+func (gs *GameSession) endCurrentTarget(ctx context.Context, outcome TargetOutcome) {
+	target := gs.GetCurrentTarget()
+	if target == nil || target.Outcome != TargetPending {
+		return
+	}
+
+	now := time.Now()
+	target.EndTime = &now
+	target.Outcome = outcome
+
+	if outcome != TargetUnplayed {
+		gs.recordTargetResult(ctx, *target)
 	}
+}
 
-	return CalculateGameScore(elapsedSeconds, totalWrongGuesses, gs.CurrentPlayerIndex)
+func (gs *GameSession) GetTotalElapsedTime() int {
+	return int(time.Since(gs.StartTime).Seconds())
 }
 
 func (gs *GameSession) CheckCorrectGuess(guessedPlayerName string) bool {
@@ -118,17 +213,17 @@ func (gs *GameSession) CheckCorrectGuess(guessedPlayerName string) bool {
 	return guessedPlayer.PlayerUsername == targetPlayer.PlayerUsername
 }
 
-func (gs *GameSession) MoveToNextPlayer() bool {
+func (gs *GameSession) MoveToNextPlayer(ctx context.Context) bool {
 	gs.CurrentPlayerIndex++
 
 	if gs.CurrentPlayerIndex >= len(gs.SelectedPlayers) {
 		return false
 	}
 
-	gs.Guesses = make([]GuessResult, 0)
+	gs.startTarget(time.Now())
 
-	log.Printf("Session %s moved to player %d/%d",
-		gs.SessionID, gs.CurrentPlayerIndex+1, len(gs.SelectedPlayers))
+	slog.DebugContext(ctx, "Session moved to next player", sessionAttr(gs.SessionID),
+		"player", gs.CurrentPlayerIndex+1, "players", len(gs.SelectedPlayers))
 
 	return true
 }
@@ -139,7 +234,7 @@ func (gs *GameSession) IsGameOver() bool {
 	}
 
 	elapsedSeconds := gs.GetTotalElapsedTime()
-	if elapsedSeconds >= TotalGameTime {
+	if elapsedSeconds >= gs.Settings.TotalGameTimeSeconds {
 		return true
 	}
 
@@ -150,32 +245,45 @@ func (gs *GameSession) IsGameOver() bool {
 	return false
 }
 
-func (gs *GameSession) CalculateFinalScore() int {
+func (gs *GameSession) CalculateFinalScore(ctx context.Context) int {
 	if !gs.IsCompleted {
-		log.Printf("Game ending without completion for session %s at player %d/%d",
-			gs.SessionID, gs.CurrentPlayerIndex+1, len(gs.SelectedPlayers))
+		slog.InfoContext(ctx, "Game ending without completion", sessionAttr(gs.SessionID),
+			"player", gs.CurrentPlayerIndex+1, "players", len(gs.SelectedPlayers))
 	}
 
-	completedPlayers := gs.CurrentPlayerIndex
-	if gs.IsCompleted && completedPlayers > len(gs.SelectedPlayers) {
-		completedPlayers = len(gs.SelectedPlayers)
+	playersFound := 0
+	for _, target := range gs.Targets {
+		if target.Outcome == TargetFound {
+			playersFound++
+		}
 	}
 
-	if completedPlayers == len(gs.SelectedPlayers) {
-		completionBonus := 10000
-		gs.Score += completionBonus
-		log.Printf("Session %s completed all players! Bonus: %d points", gs.SessionID, completionBonus)
+	if EarnsCompletionBonus(playersFound, len(gs.SelectedPlayers)) {
+		bonus := gs.Settings.Scoring.CompletionBonus
+		gs.Score += bonus
+		slog.InfoContext(ctx, "Session found every player", sessionAttr(gs.SessionID), "bonus", bonus)
 	}
 
 	return gs.Score
 }
 
-func (gs *GameSession) CompleteSession() {
+func (gs *GameSession) CompleteSession(ctx context.Context) {
 	gs.IsCompleted = true
 	now := time.Now()
 	gs.CompletionTime = &now
+	sessionsCompleted.WithLabelValues(gs.Difficulty).Inc()
+
+	// A target drawn after the clock ran out was never actually shown to the player.
+	if target := gs.GetCurrentTarget(); target != nil {
+		timeLimit := gs.StartTime.Add(time.Duration(gs.Settings.TotalGameTimeSeconds) * time.Second)
+		if target.StartTime.Before(timeLimit) {
+			gs.endCurrentTarget(ctx, TargetMissed)
+		} else {
+			gs.endCurrentTarget(ctx, TargetUnplayed)
+		}
+	}
 
-	finalScore := gs.CalculateFinalScore()
+	finalScore := gs.CalculateFinalScore(ctx)
 
 	duration := int(time.Since(gs.StartTime).Seconds())
 	completedPlayers := gs.CurrentPlayerIndex
@@ -183,11 +291,79 @@ func (gs *GameSession) CompleteSession() {
 		completedPlayers = len(gs.SelectedPlayers)
 	}
 
-	log.Printf("Session %s completed. Players: %d/%d, Final Score: %d, Duration: %ds",
-		gs.SessionID, completedPlayers, len(gs.SelectedPlayers), finalScore, duration)
+	slog.InfoContext(ctx, "Session completed", sessionAttr(gs.SessionID), "difficulty", gs.Difficulty,
+		"players_completed", completedPlayers, "players", len(gs.SelectedPlayers), "score", finalScore, "duration_s", duration)
+
+	analysis := AnalyzeSession(gs)
+	gs.Analysis = &analysis
+	if analysis.Flagged() {
+		slog.WarnContext(ctx, "Session looks automated", sessionAttr(gs.SessionID),
+			"suspicion", analysis.Suspicion, "flags", analysis.Flags)
+	}
+
+	gs.saveRun(ctx)
+}
+
+func (gs *GameSession) BuildRun() Run {
+	lineup := make([]string, len(gs.SelectedPlayers))
+	for i, player := range gs.SelectedPlayers {
+		lineup[i] = player.ID
+	}
+
+	playersFound := 0
+	for _, target := range gs.Targets {
+		if target.Outcome == TargetFound {
+			playersFound++
+		}
+	}
+
+	endTime := time.Now()
+	if gs.CompletionTime != nil {
+		endTime = *gs.CompletionTime
+	}
+
+	return Run{
+		ID:           gs.RunID,
+		Difficulty:   gs.Difficulty,
+		Score:        gs.Score,
+		StartTime:    gs.StartTime,
+		EndTime:      endTime,
+		PlayersFound: playersFound,
+		Lineup:       lineup,
+		Targets:      gs.Targets,
+		PlayerID:     gs.PlayerID,
+		AccountID:    gs.AccountID,
+		Hidden:       gs.Analysis != nil && gs.Analysis.Flagged(),
+	}
 }
 
-func ValidateGuess(session *GameSession, guessedPlayerName string) (*GuessResult, error) {
+func (gs *GameSession) saveRun(ctx context.Context) {
+	runID, err := generateRunID()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error generating run ID", sessionAttr(gs.SessionID), "error", err)
+		return
+	}
+
+	run := gs.BuildRun()
+	run.ID = runID
+
+	if transcriptSigner != nil {
+		transcript, err := transcriptSigner.Sign(gs.BuildTranscript(ctx, runID))
+		if err != nil {
+			slog.ErrorContext(ctx, "Error signing transcript", sessionAttr(gs.SessionID), "error", err)
+		}
+		run.Transcript = transcript
+	}
+
+	if err := store.SaveRun(run); err != nil {
+		slog.ErrorContext(ctx, "Error saving run", sessionAttr(gs.SessionID), "error", err)
+		return
+	}
+
+	gs.RunID = runID
+}
+
+func ValidateGuess(ctx context.Context, session *GameSession, guessedPlayerName string) (*GuessResult, error) {
 	if session == nil {
 		return nil, fmt.Errorf("session is nil")
 	}
@@ -226,15 +402,18 @@ func ValidateGuess(session *GameSession, guessedPlayerName string) (*GuessResult
 		IsCorrect:     isCorrect,
 	}
 
-	session.Guesses = append(session.Guesses, guessResult)
+	currentTarget := session.GetCurrentTarget()
+	currentTarget.Guesses = append(currentTarget.Guesses, guessResult)
 
 	if isCorrect {
-		session.handleCorrectGuess()
+		guessesTotal.WithLabelValues("correct").Inc()
+		session.handleCorrectGuess(ctx)
 	} else {
+		guessesTotal.WithLabelValues("wrong").Inc()
 
 		if session.IsGameOver() {
 
-			session.handleTimeLimit()
+			session.handleTimeLimit(ctx)
 		}
 	}
 
@@ -395,30 +574,63 @@ func abs(x float64) float64 {
 	return x
 }
 
-func (gs *GameSession) handleCorrectGuess() {
+func (gs *GameSession) handleCorrectGuess(ctx context.Context) {
 
-	totalElapsed := gs.GetTotalElapsedTime()
+	guesses := gs.GetCurrentTarget().Guesses
+	totalElapsed := ElapsedSeconds(gs.StartTime, guesses[len(guesses)-1].Timestamp)
+	wrongGuesses := len(guesses) - 1
 
-	wrongGuesses := len(gs.Guesses) - 1
-	if wrongGuesses < 0 {
-		wrongGuesses = 0
+	playerPoints := CalculatePlayerPoints(gs.Settings, totalElapsed, wrongGuesses)
+	gs.Score += playerPoints
+
+	gs.endCurrentTarget(ctx, TargetFound)
+
+	if !gs.MoveToNextPlayer(ctx) {
+
+		gs.CompleteSession(ctx)
 	}
+}
 
-	playerPoints := CalculatePlayerPoints(totalElapsed, wrongGuesses)
-	gs.Score += playerPoints
+func (gs *GameSession) handleTimeLimit(ctx context.Context) {
+	slog.InfoContext(ctx, "Time limit reached", sessionAttr(gs.SessionID),
+		"player", gs.CurrentPlayerIndex+1, "players", len(gs.SelectedPlayers))
 
-	if !gs.MoveToNextPlayer() {
+	gs.endCurrentTarget(ctx, TargetMissed)
 
-		gs.CompleteSession()
+	if !gs.MoveToNextPlayer(ctx) {
+		gs.CompleteSession(ctx)
 	}
 }
 
-func (gs *GameSession) handleTimeLimit() {
-	log.Printf("Time limit reached in session %s for player %d/%d (2 minutes elapsed)",
-		gs.SessionID, gs.CurrentPlayerIndex+1, len(gs.SelectedPlayers))
+func (gs *GameSession) recordTargetResult(ctx context.Context, target TargetAttempt) {
+	guesses := make([]TargetGuess, 0, len(target.Guesses))
+	for _, guess := range target.Guesses {
+		exact := make([]string, 0)
+		for attribute, comparison := range guess.Comparisons {
+			if comparison == ComparisonExact {
+				exact = append(exact, attribute)
+			}
+		}
+		sort.Strings(exact)
+
+		guesses = append(guesses, TargetGuess{
+			PlayerID: guess.GuessedPlayer.ID,
+			Exact:    exact,
+		})
+	}
+
+	result := TargetResult{
+		SessionID:  gs.SessionID,
+		Difficulty: gs.Difficulty,
+		PlayerID:   target.PlayerID,
+		Found:      target.Outcome == TargetFound,
+		Guesses:    guesses,
+		StartTime:  target.StartTime,
+		EndTime:    *target.EndTime,
+	}
 
-	if !gs.MoveToNextPlayer() {
-		gs.CompleteSession()
+	if err := store.AddTargetResult(result); err != nil {
+		slog.ErrorContext(ctx, "Error recording target result", sessionAttr(gs.SessionID), "error", err)
 	}
 }
 
@@ -428,7 +640,7 @@ func GetTimeRemaining(session *GameSession) int {
 	}
 
 	elapsedSeconds := session.GetTotalElapsedTime()
-	remainingSeconds := TotalGameTime - elapsedSeconds
+	remainingSeconds := session.Settings.TotalGameTimeSeconds - elapsedSeconds
 
 	if remainingSeconds < 0 {
 		return 0
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// Set at build time, e.g. go build -ldflags "-X main.buildVersion=1.4.0 -X main.buildCommit=$(git rev-parse HEAD)".
+// Without them the commit comes from the VCS stamp Go embeds when building inside a checkout.
+var (
+	buildVersion = "dev"
+	buildCommit  = ""
+	buildTime    = ""
+)
+
+// templateError keeps the parse error when the server fell back to an empty template set.
+var templateError error
+
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type DatasetInfo struct {
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+	Players int    `json:"players"`
+}
+
+type VersionResponse struct {
+	Version       string      `json:"version"`
+	Commit        string      `json:"commit,omitempty"`
+	BuildTime     string      `json:"buildTime,omitempty"`
+	Modified      bool        `json:"modified,omitempty"`
+	GoVersion     string      `json:"goVersion"`
+	SchemaVersion int         `json:"schemaVersion,omitempty"`
+	Dataset       DatasetInfo `json:"dataset"`
+}
+
+func writeHealthJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// healthzHandler only shows the process is up and serving; it touches nothing else.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeHealthJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// readyzHandler reports whether the server can actually play games: the dataset is loaded,
+// the database answers and the templates parsed. Failure details go to the log, not the response.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	checks := map[string]string{"dataset": "ok", "database": "ok", "templates": "ok"}
+	ready := true
+
+	if !IsGameDataLoaded() {
+		checks["dataset"] = "failed"
+		ready = false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	if err := store.Ping(ctx); err != nil {
+		slog.WarnContext(r.Context(), "Readiness check failed", "check", "database", "error", err)
+		checks["database"] = "failed"
+		ready = false
+	}
+
+	if templateError != nil {
+		slog.WarnContext(r.Context(), "Readiness check failed", "check", "templates", "error", templateError)
+		checks["templates"] = "failed"
+		ready = false
+	}
+
+	if !ready {
+		writeHealthJSON(w, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+
+	writeHealthJSON(w, http.StatusOK, HealthResponse{Status: "ready", Checks: checks})
+}
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := VersionResponse{
+		Version:   buildVersion,
+		Commit:    buildCommit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		Dataset:   GetDatasetInfo(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok && response.Commit == "" {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				response.Commit = setting.Value
+			case "vcs.time":
+				response.BuildTime = setting.Value
+			case "vcs.modified":
+				response.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if version, err := store.SchemaVersion(); err == nil {
+		response.SchemaVersion = version
+	} else {
+		slog.WarnContext(r.Context(), "Error reading schema version", "error", err)
+	}
+
+	writeHealthJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLeaderboardPageSize = 10
+	maxLeaderboardPageSize     = 100
+	defaultLeaderboardRadius   = 5
+	maxLeaderboardRadius       = 25
+	homeLeaderboardSize        = 10
+)
+
+type LeaderboardWindow string
+
+const (
+	WindowToday   LeaderboardWindow = "today"
+	WindowWeek    LeaderboardWindow = "week"
+	WindowMonth   LeaderboardWindow = "month"
+	WindowSeason  LeaderboardWindow = "season"
+	WindowAllTime LeaderboardWindow = "all"
+)
+
+var leaderboardWindows = []LeaderboardWindow{WindowToday, WindowWeek, WindowMonth, WindowSeason, WindowAllTime}
+
+// LeaderboardView selects between each username's best run and every submitted run.
+type LeaderboardView string
+
+const (
+	ViewBest LeaderboardView = "best"
+	ViewAll  LeaderboardView = "all"
+)
+
+var leaderboardViews = []LeaderboardView{ViewBest, ViewAll}
+
+var leaderboardDifficulties = []string{"facile", "moyen", "difficile"}
+
+type LeaderboardResponse struct {
+	Success      bool                        `json:"success"`
+	Message      string                      `json:"message,omitempty"`
+	Difficulty   string                      `json:"difficulty,omitempty"`
+	Window       LeaderboardWindow           `json:"window,omitempty"`
+	View         LeaderboardView             `json:"view,omitempty"`
+	Page         int                         `json:"page,omitempty"`
+	PageSize     int                         `json:"pageSize,omitempty"`
+	TotalEntries int                         `json:"totalEntries"`
+	TotalPages   int                         `json:"totalPages,omitempty"`
+	Position     int                         `json:"position,omitempty"`
+	Entries      []FormattedLeaderboardEntry `json:"entries"`
+}
+
+type LeaderboardTab struct {
+	Difficulty string
+	Window     LeaderboardWindow
+	View       LeaderboardView
+	Entries    []FormattedLeaderboardEntry
+}
+
+func ParseLeaderboardWindow(window string) (LeaderboardWindow, bool) {
+	if window == "" {
+		return WindowAllTime, true
+	}
+
+	for _, w := range leaderboardWindows {
+		if string(w) == window {
+			return w, true
+		}
+	}
+
+	return "", false
+}
+
+// Since returns the start of the window containing now; the all-time window has no start.
+// Weeks start on Monday and a season is the calendar year, matching the competitive LoL season.
+func (w LeaderboardWindow) Since(now time.Time) (time.Time, bool) {
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+
+	switch w {
+	case WindowToday:
+		return today, true
+	case WindowWeek:
+		offset := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, -offset), true
+	case WindowMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, now.Location()), true
+	case WindowSeason:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, now.Location()), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func (w LeaderboardWindow) Label() string {
+	switch w {
+	case WindowToday:
+		return "Aujourd'hui"
+	case WindowWeek:
+		return "Semaine"
+	case WindowMonth:
+		return "Mois"
+	case WindowSeason:
+		return "Saison"
+	default:
+		return "Tout temps"
+	}
+}
+
+func ParseLeaderboardView(view string) (LeaderboardView, bool) {
+	if view == "" {
+		return ViewBest, true
+	}
+
+	for _, v := range leaderboardViews {
+		if string(v) == view {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+func (v LeaderboardView) Label() string {
+	if v == ViewAll {
+		return "Toutes les parties"
+	}
+	return "Meilleur par joueur"
+}
+
+// queryInt reads a positive integer query parameter, falling back to def when absent and clamping to limit.
+func queryInt(r *http.Request, name string, def, limit int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return min(n, limit), true
+}
+
+func writeLeaderboardResponse(w http.ResponseWriter, status int, response LeaderboardResponse) {
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func leaderboardAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	window, ok := ParseLeaderboardWindow(query.Get("window"))
+	if !ok {
+		writeLeaderboardResponse(w, http.StatusBadRequest, LeaderboardResponse{Message: "Invalid window"})
+		return
+	}
+
+	view, ok := ParseLeaderboardView(query.Get("view"))
+	if !ok {
+		writeLeaderboardResponse(w, http.StatusBadRequest, LeaderboardResponse{Message: "Invalid view"})
+		return
+	}
+
+	difficulty := query.Get("difficulty")
+
+	var session *GameSession
+	if sessionID := query.Get("around"); sessionID != "" {
+		var exists bool
+		session, exists = GetSession(r.Context(), sessionID)
+		if !exists {
+			writeLeaderboardResponse(w, http.StatusNotFound, LeaderboardResponse{Message: "Session not found"})
+			return
+		}
+		if difficulty == "" {
+			difficulty = session.Difficulty
+		}
+	}
+
+	if !slices.Contains(leaderboardDifficulties, difficulty) {
+		writeLeaderboardResponse(w, http.StatusBadRequest, LeaderboardResponse{Message: "Invalid difficulty"})
+		return
+	}
+
+	total, err := store.CountLeaderboardByDifficulty(difficulty, window, view)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error counting leaderboard", "difficulty", difficulty, "window", window, "error", err)
+		writeLeaderboardResponse(w, http.StatusInternalServerError, LeaderboardResponse{Message: "Failed to load leaderboard"})
+		return
+	}
+
+	response := LeaderboardResponse{
+		Success:      true,
+		Difficulty:   difficulty,
+		Window:       window,
+		View:         view,
+		TotalEntries: total,
+	}
+
+	if session != nil {
+		radius, ok := queryInt(r, "radius", defaultLeaderboardRadius, maxLeaderboardRadius)
+		if !ok {
+			writeLeaderboardResponse(w, http.StatusBadRequest, LeaderboardResponse{Message: "Invalid radius"})
+			return
+		}
+
+		var entries []LeaderboardEntry
+		if session.RunID != "" {
+			entries, response.Position, err = store.GetLeaderboardAroundRun(difficulty, window, view, session.RunID, radius)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error loading leaderboard around session", sessionAttr(session.SessionID), "error", err)
+				writeLeaderboardResponse(w, http.StatusInternalServerError, LeaderboardResponse{Message: "Failed to load leaderboard"})
+				return
+			}
+		}
+
+		if response.Position == 0 {
+			writeLeaderboardResponse(w, http.StatusNotFound, LeaderboardResponse{Message: "Score not submitted to this leaderboard"})
+			return
+		}
+
+		response.Entries = FormatLeaderboardEntries(entries)
+		writeLeaderboardResponse(w, http.StatusOK, response)
+		return
+	}
+
+	pageSize, ok := queryInt(r, "pageSize", defaultLeaderboardPageSize, maxLeaderboardPageSize)
+	if !ok {
+		writeLeaderboardResponse(w, http.StatusBadRequest, LeaderboardResponse{Message: "Invalid page size"})
+		return
+	}
+
+	totalPages := (total + pageSize - 1) / pageSize
+
+	// Pages past the end clamp to the last page
+	page, ok := queryInt(r, "page", 1, max(totalPages, 1))
+	if !ok {
+		writeLeaderboardResponse(w, http.StatusBadRequest, LeaderboardResponse{Message: "Invalid page"})
+		return
+	}
+
+	entries, err := store.GetLeaderboardPageByDifficulty(difficulty, window, view, (page-1)*pageSize, pageSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting leaderboard page", "difficulty", difficulty, "window", window, "page", page, "error", err)
+		writeLeaderboardResponse(w, http.StatusInternalServerError, LeaderboardResponse{Message: "Failed to load leaderboard"})
+		return
+	}
+
+	response.Page = page
+	response.PageSize = pageSize
+	response.TotalPages = totalPages
+	response.Entries = FormatLeaderboardEntries(entries)
+
+	writeLeaderboardResponse(w, http.StatusOK, response)
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -12,24 +15,97 @@ import (
 
 var templates *template.Template
 
-func init() {
+func initServer() {
 	if err := InitializeGameData(); err != nil {
-		log.Fatalf("Failed to initialize game data: %v", err)
+		fatal("Failed to initialize game data", err)
 	}
 
 	if err := InitDatabase(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to initialize database", err)
 	}
 
 	var err error
+	gameConfig, err = LoadGameConfig()
+	if err != nil {
+		fatal("Failed to load game config", err)
+	}
+	err = gameConfig.CheckPlayerPools(func(difficulty string) int {
+		return len(GetPlayersByDifficulty(difficulty))
+	})
+	if err != nil {
+		fatal("Invalid game config", err)
+	}
+
+	if err := RestoreSessions(); err != nil {
+		slog.Error("Error restoring saved sessions", "error", err)
+	}
+
 	templates, err = template.ParseGlob("templates/*.html")
 	if err != nil {
-		log.Printf("Warning: Could not parse templates: %v", err)
+		slog.Warn("Could not parse templates", "error", err)
 		templates = template.New("empty")
+		templateError = err
+	}
+
+	usernamePolicy, err = LoadUsernamePolicy()
+	if err != nil {
+		fatal("Failed to load username policy", err)
 	}
 }
 
 func main() {
+	if err := InitLogging(os.Stderr); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fatal("Command failed", fmt.Errorf("%s: %v", os.Args[1], err))
+		}
+		return
+	}
+
+	initServer()
+
+	backupConfig, err := LoadBackupConfig(databaseConfig)
+	if err != nil {
+		fatal("Failed to load backup config", err)
+	}
+	StartBackupScheduler(backupConfig)
+
+	transcriptSigner, err = LoadTranscriptSigner(databaseConfig)
+	if err != nil {
+		fatal("Failed to load transcript signer", err)
+	}
+
+	trustedProxies, err = LoadTrustedProxies()
+	if err != nil {
+		fatal("Failed to load trusted proxies", err)
+	}
+
+	forceSecureCookies, err = LoadCookieSecurity()
+	if err != nil {
+		fatal("Failed to load cookie settings", err)
+	}
+
+	publicBaseURL, err = LoadPublicBaseURL()
+	if err != nil {
+		fatal("Failed to load public base URL", err)
+	}
+	if publicBaseURL == "" {
+		slog.Warn("PUBLIC_BASE_URL is not set, share pages will use relative links")
+	}
+
+	rateLimitRules, err = LoadRateLimitRules()
+	if err != nil {
+		fatal("Failed to load rate limits", err)
+	}
+	StartRateLimitPruner()
+
+	serverConfig, err := LoadServerConfig()
+	if err != nil {
+		fatal("Failed to load server config", err)
+	}
 
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 	http.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("assets"))))
@@ -41,21 +117,44 @@ func main() {
 
 	http.HandleFunc("/", homeHandler)
 	http.HandleFunc("/game", gameHandler)
-
-	http.HandleFunc("/api/start-game", startGameHandler)
-	http.HandleFunc("/api/guess", guessHandler)
-	http.HandleFunc("/api/autocomplete", autocompleteHandler)
-	http.HandleFunc("/api/submit-score", submitScoreHandler)
-	http.HandleFunc("/api/end-game", endGameHandler)
-	http.HandleFunc("/api/config", configHandler)
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	http.HandleFunc("/run/{id}", runHandler)
+	http.HandleFunc("/run/{id}/transcript.json", runTranscriptHandler)
+	http.HandleFunc("/profile", profileHandler)
+	http.HandleFunc("/profile/{name}", profileHandler)
+	http.HandleFunc("/share/{id}", sharePageHandler)
+	http.HandleFunc("/share/{id}/image.png", shareImageHandler)
+
+	http.HandleFunc("/api/start-game", rateLimit("start-game", startGameHandler))
+	http.HandleFunc("/api/guess", rateLimit("guess", guessHandler))
+	http.HandleFunc("/api/autocomplete", rateLimit("autocomplete", autocompleteHandler))
+	http.HandleFunc("/api/submit-score", rateLimit("submit-score", submitScoreHandler))
+	http.HandleFunc("/api/leaderboard", rateLimit("leaderboard", leaderboardAPIHandler))
+	http.HandleFunc("/api/end-game", rateLimit("end-game", endGameHandler))
+	http.HandleFunc("/api/config", rateLimit("config", configHandler))
+	http.HandleFunc("/metrics", metricsHandler())
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/readyz", readyzHandler)
+	http.HandleFunc("/version", versionHandler)
+	http.HandleFunc("/api/transcripts/key", rateLimit("transcripts", transcriptKeyHandler))
+	http.HandleFunc("/api/register", rateLimit("register", registerHandler))
+	http.HandleFunc("/api/login", rateLimit("login", loginHandler))
+	http.HandleFunc("/api/logout", rateLimit("logout", logoutHandler))
+	http.HandleFunc("/api/me", rateLimit("me", meHandler))
+	http.HandleFunc("/api/profile", rateLimit("profile", profileAPIHandler))
+	http.HandleFunc("/api/profile/{name}", rateLimit("profile", profileAPIHandler))
+	http.HandleFunc("/api/stats/players", rateLimit("stats", allPlayerStatsHandler))
+	http.HandleFunc("/api/stats/players/{id}", rateLimit("stats", playerStatsHandler))
+	http.HandleFunc("/admin", rateLimit("admin", adminHandler))
+	http.HandleFunc("/admin/entries/{id}/{action}", rateLimit("admin", adminEntryHandler))
+	http.HandleFunc("/admin/bans", rateLimit("admin", adminBanHandler))
+	http.HandleFunc("/admin/bans/remove", rateLimit("admin", adminUnbanHandler))
+	http.HandleFunc("/api/admin/backup", rateLimit("admin", adminBackupHandler))
+	http.HandleFunc("/api/admin/leaderboard/export", rateLimit("admin", adminExportHandler))
+	http.HandleFunc("/api/admin/leaderboard/import", rateLimit("admin", adminImportHandler))
+
+	if err := Serve(serverConfig, withRequestID(instrumentHTTP(http.DefaultServeMux))); err != nil {
+		fatal("Server stopped", err)
 	}
-
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
@@ -64,42 +163,49 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	facileLeaderboard, err := GetFormattedLeaderboardByDifficulty(10, "facile")
-	if err != nil {
-		log.Printf("Error getting facile leaderboard: %v", err)
-		facileLeaderboard = []FormattedLeaderboardEntry{}
-	}
-
-	moyenLeaderboard, err := GetFormattedLeaderboardByDifficulty(10, "moyen")
-	if err != nil {
-		log.Printf("Error getting moyen leaderboard: %v", err)
-		moyenLeaderboard = []FormattedLeaderboardEntry{}
-	}
+	// Only the default tabs are rendered here; the page fetches other windows and views from /api/leaderboard
+	var leaderboards []LeaderboardTab
+	for _, difficulty := range leaderboardDifficulties {
+		entries, err := GetFormattedLeaderboardByDifficulty(homeLeaderboardSize, difficulty, WindowAllTime, ViewBest)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting leaderboard", "difficulty", difficulty, "error", err)
+			entries = []FormattedLeaderboardEntry{}
+		}
 
-	difficileLeaderboard, err := GetFormattedLeaderboardByDifficulty(10, "difficile")
-	if err != nil {
-		log.Printf("Error getting difficile leaderboard: %v", err)
-		difficileLeaderboard = []FormattedLeaderboardEntry{}
+		leaderboards = append(leaderboards, LeaderboardTab{
+			Difficulty: difficulty,
+			Window:     WindowAllTime,
+			View:       ViewBest,
+			Entries:    entries,
+		})
 	}
 
 	difficultyInfo := GetDifficultyInfo()
 
 	data := struct {
-		FacileLeaderboard    []FormattedLeaderboardEntry
-		MoyenLeaderboard     []FormattedLeaderboardEntry
-		DifficileLeaderboard []FormattedLeaderboardEntry
-		DifficultyInfo       map[string]map[string]interface{}
+		Leaderboards   []LeaderboardTab
+		PageSize       int
+		Windows        []LeaderboardWindow
+		DefaultWindow  LeaderboardWindow
+		Views          []LeaderboardView
+		DefaultView    LeaderboardView
+		DifficultyInfo map[string]map[string]interface{}
+		Account        *Account
 	}{
-		FacileLeaderboard:    facileLeaderboard,
-		MoyenLeaderboard:     moyenLeaderboard,
-		DifficileLeaderboard: difficileLeaderboard,
-		DifficultyInfo:       difficultyInfo,
+		Leaderboards:   leaderboards,
+		PageSize:       homeLeaderboardSize,
+		Windows:        leaderboardWindows,
+		DefaultWindow:  WindowAllTime,
+		Views:          leaderboardViews,
+		DefaultView:    ViewBest,
+		DifficultyInfo: difficultyInfo,
+		Account:        CurrentAccount(r),
 	}
 
-	err = templates.ExecuteTemplate(w, "index.html", data)
+	err := templates.ExecuteTemplate(w, "index.html", data)
 	if err != nil {
 		http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		log.Printf("Template error: %v", err)
+		slog.ErrorContext(r.Context(), "Template error", "error", err)
 	}
 }
 
@@ -111,19 +217,24 @@ func gameHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	difficultyInfo := GetDifficultyInfo()
+	settings := gameConfig.For(difficulty)
 
 	data := struct {
 		Difficulty     string
 		DifficultyInfo map[string]map[string]interface{}
+		Settings       GameSettings
+		TimeLimit      string
 	}{
 		Difficulty:     difficulty,
 		DifficultyInfo: difficultyInfo,
+		Settings:       settings,
+		TimeLimit:      FormatClock(settings.TotalGameTimeSeconds),
 	}
 
 	err := templates.ExecuteTemplate(w, "game.html", data)
 	if err != nil {
 		http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		log.Printf("Template error: %v", err)
+		slog.ErrorContext(r.Context(), "Template error", "error", err)
 	}
 }
 
@@ -158,10 +269,23 @@ type SubmitScoreRequest struct {
 	Username  string `json:"username"`
 }
 
+// Error codes returned by /api/submit-score, alongside the username policy codes.
+const (
+	SubmitErrorInvalidRequest  = "invalid_request"
+	SubmitErrorBanned          = "banned"
+	SubmitErrorSessionNotFound = "session_not_found"
+	SubmitErrorSessionActive   = "session_active"
+	SubmitErrorSubmitted       = "already_submitted"
+	SubmitErrorInternal        = "internal_error"
+)
+
 type SubmitScoreResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
-	Rank    int    `json:"rank,omitempty"`
+	Success bool                      `json:"success"`
+	Message string                    `json:"message,omitempty"`
+	Code    string                    `json:"code,omitempty"`
+	Pending bool                      `json:"pendingReview,omitempty"`
+	Rank    int                       `json:"rank,omitempty"`
+	Ranks   map[LeaderboardWindow]int `json:"ranks,omitempty"`
 }
 
 type StartGameRequest struct {
@@ -178,7 +302,7 @@ func startGameHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req StartGameRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request body: %v", err)
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
 		response := StartGameResponse{
 			Success: false,
 			Message: "Invalid request format",
@@ -193,9 +317,16 @@ func startGameHandler(w http.ResponseWriter, r *http.Request) {
 		difficulty = "difficile"
 	}
 
-	session, err := CreateNewSessionWithDifficulty(difficulty)
+	playerID := EnsurePlayerID(w, r)
+
+	var accountID int64
+	if account := CurrentAccount(r); account != nil {
+		accountID = account.ID
+	}
+
+	session, err := CreateNewSessionWithDifficulty(r.Context(), difficulty, playerID, accountID)
 	if err != nil {
-		log.Printf("Error creating session with difficulty %s: %v", difficulty, err)
+		slog.ErrorContext(r.Context(), "Error creating session", "difficulty", difficulty, "error", err)
 		response := StartGameResponse{
 			Success: false,
 			Message: "Failed to create game session",
@@ -242,7 +373,7 @@ func guessHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, exists := GetSession(req.SessionID)
+	session, exists := GetSession(r.Context(), req.SessionID)
 	if !exists {
 		response := GuessResponse{
 			Success: false,
@@ -265,9 +396,9 @@ func guessHandler(w http.ResponseWriter, r *http.Request) {
 
 	isCorrect := session.CheckCorrectGuess(req.PlayerName)
 
-	result, err := ValidateGuess(session, req.PlayerName)
+	result, err := ValidateGuess(r.Context(), session, req.PlayerName)
 	if err != nil {
-		log.Printf("Error validating guess: %v", err)
+		slog.InfoContext(r.Context(), "Rejected guess", sessionAttr(req.SessionID), "error", err)
 
 		errorMsg := err.Error()
 		if strings.Contains(errorMsg, "player not found:") {
@@ -321,13 +452,10 @@ func autocompleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	difficulty := "difficile"
 	if sessionID != "" {
-		if session, exists := GetSession(sessionID); exists {
+		if session, exists := GetSession(r.Context(), sessionID); exists {
 			difficulty = session.Difficulty
-		} else {
-			log.Printf("Autocomplete: session %s not found, using default difficulty", sessionID)
+			RecordAutocomplete(sessionID, time.Now())
 		}
-	} else {
-		log.Printf("Autocomplete: no session ID provided, using default difficulty")
 	}
 
 	var players []string
@@ -366,38 +494,88 @@ func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
 		response := SubmitScoreResponse{
 			Success: false,
 			Message: "Invalid request format",
+			Code:    SubmitErrorInvalidRequest,
 		}
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
+	// Registered players always submit under their account name
+	account := CurrentAccount(r)
+	if account != nil {
+		req.Username = account.Username
+	}
+
 	if req.SessionID == "" || req.Username == "" {
 		response := SubmitScoreResponse{
 			Success: false,
 			Message: "SessionID and Username are required",
+			Code:    SubmitErrorInvalidRequest,
 		}
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	username := SanitizeInput(req.Username)
-	if len(username) == 0 || len(username) > 50 {
+	username, err := usernamePolicy.Check(SanitizeInput(req.Username), account != nil)
+	if err != nil {
 		response := SubmitScoreResponse{
 			Success: false,
-			Message: "Username must be between 1 and 50 characters",
+			Message: err.Error(),
+			Code:    SubmitErrorInvalidRequest,
+		}
+		if usernameErr, ok := err.(*UsernameError); ok {
+			response.Code = usernameErr.Code
 		}
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	session, exists := GetSession(req.SessionID)
+	var accountID int64
+	if account != nil {
+		accountID = account.ID
+	} else {
+		reserved, err := IsReservedUsername(username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error checking reserved username", "username", username, "error", err)
+		}
+		if reserved {
+			response := SubmitScoreResponse{
+				Success: false,
+				Message: "This username belongs to a registered account",
+				Code:    UsernameReserved,
+			}
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	ip := clientIP(r)
+	banned, err := store.IsBanned(username, ip)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error checking bans", "username", username, "error", err)
+	}
+	if banned {
+		slog.InfoContext(r.Context(), "Rejected score from banned user", "username", username, "ip", ip)
+		response := SubmitScoreResponse{
+			Success: false,
+			Message: "You are banned from the leaderboard",
+			Code:    SubmitErrorBanned,
+		}
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	session, exists := GetSession(r.Context(), req.SessionID)
 	if !exists {
 		response := SubmitScoreResponse{
 			Success: false,
 			Message: "Session not found",
+			Code:    SubmitErrorSessionNotFound,
 		}
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(response)
@@ -408,29 +586,48 @@ func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
 		response := SubmitScoreResponse{
 			Success: false,
 			Message: "Game session is still active",
+			Code:    SubmitErrorSessionActive,
 		}
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	finalScore := session.Score
 	if !session.IsCompleted {
-		finalScore = session.CalculateFinalScore()
+		session.CompleteSession(r.Context())
+		UpdateSession(session)
 	}
+	finalScore := session.Score
 
-	err := SubmitScoreByDifficulty(username, session, session.Difficulty)
+	err = SubmitScoreByDifficulty(username, session, session.Difficulty, accountID, ip)
+	if errors.Is(err, ErrRunAlreadySubmitted) {
+		response := SubmitScoreResponse{
+			Success: false,
+			Message: "This game has already been submitted",
+			Code:    SubmitErrorSubmitted,
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
 	if err != nil {
-		log.Printf("Error adding score to leaderboard: %v", err)
+		slog.ErrorContext(r.Context(), "Error adding score to leaderboard", sessionAttr(session.SessionID), "error", err)
 		response := SubmitScoreResponse{
 			Success: false,
 			Message: "Failed to save score to leaderboard",
+			Code:    SubmitErrorInternal,
 		}
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
+	if session.RunID != "" {
+		if err := store.SetRunOwner(session.RunID, username, accountID); err != nil {
+			slog.ErrorContext(r.Context(), "Error linking run", "run", session.RunID, "username", username, "error", err)
+		}
+	}
+
 	var totalDuration int
 	if session.CompletionTime != nil {
 		totalDuration = int(session.CompletionTime.Sub(session.StartTime).Seconds())
@@ -438,32 +635,45 @@ func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
 		totalDuration = int(time.Since(session.StartTime).Seconds())
 	}
 
-	rank, err := GetPlayerRankByDifficulty(finalScore, totalDuration, session.Difficulty)
+	ranks, err := GetPlayerRanksByDifficulty(finalScore, totalDuration, session.Difficulty)
 	if err != nil {
-		log.Printf("Error calculating rank: %v", err)
+		slog.ErrorContext(r.Context(), "Error calculating rank", "error", err)
 
-		rank = 0
+		ranks = nil
 	}
+	rank := ranks[WindowAllTime]
 
-	log.Printf("Score submitted for user %s: %d points (rank #%d) (session %s)", username, finalScore, rank, req.SessionID)
+	slog.InfoContext(r.Context(), "Score submitted", sessionAttr(session.SessionID), "username", username, "score", finalScore, "rank", rank)
 
 	response := SubmitScoreResponse{
 		Success: true,
 		Message: "Score submitted successfully",
 		Rank:    rank,
+		Ranks:   ranks,
 	}
 
+	status := "accepted"
+	if session.Analysis != nil && session.Analysis.Flagged() {
+		response.Message = "Score submitted, it will appear on the leaderboard once reviewed"
+		response.Pending = true
+		status = "pending_review"
+	}
+	scoreSubmissions.WithLabelValues(session.Difficulty, status).Inc()
+
 	json.NewEncoder(w).Encode(response)
 }
 
 type EndGameRequest struct {
-	SessionID string `json:"sessionId"`
+	SessionID   string `json:"sessionId"`
+	ShareFormat string `json:"shareFormat"`
 }
 
 type EndGameResponse struct {
 	Success      bool    `json:"success"`
 	Message      string  `json:"message,omitempty"`
 	MissedPlayer *Player `json:"missed_player,omitempty"`
+	RunID        string  `json:"runId,omitempty"`
+	ShareText    string  `json:"shareText,omitempty"`
 }
 
 func endGameHandler(w http.ResponseWriter, r *http.Request) {
@@ -495,7 +705,7 @@ func endGameHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, exists := GetSession(req.SessionID)
+	session, exists := GetSession(r.Context(), req.SessionID)
 	if !exists {
 		response := EndGameResponse{
 			Success: false,
@@ -507,7 +717,7 @@ func endGameHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !session.IsCompleted {
-		session.CompleteSession()
+		session.CompleteSession(r.Context())
 		UpdateSession(session)
 	}
 
@@ -518,38 +728,40 @@ func endGameHandler(w http.ResponseWriter, r *http.Request) {
 		missedPlayer = &currentPlayer
 	}
 
+	run := session.BuildRun()
+
 	response := EndGameResponse{
 		Success:      true,
 		Message:      "Game session ended successfully",
 		MissedPlayer: missedPlayer,
+		RunID:        session.RunID,
+		ShareText:    BuildShareText(&run, ParseShareFormat(req.ShareFormat)),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-type GameConfig struct {
-	TotalGameTimeSeconds int `json:"totalGameTimeSeconds"`
-	PlayersPerSession    int `json:"playersPerSession"`
-}
-
 type ConfigResponse struct {
-	Success bool        `json:"success"`
-	Config  *GameConfig `json:"config,omitempty"`
-	Message string      `json:"message,omitempty"`
+	Success      bool                    `json:"success"`
+	Config       *GameSettings           `json:"config,omitempty"`
+	Difficulties map[string]GameSettings `json:"difficulties,omitempty"`
+	Message      string                  `json:"message,omitempty"`
 }
 
 func configHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == "GET" {
-		config := &GameConfig{
-			TotalGameTimeSeconds: TotalGameTime,
-			PlayersPerSession:    PlayersPerSession,
+		// Config holds the rules of the requested difficulty, the defaults without one
+		config := gameConfig.Defaults
+		if difficulty := r.URL.Query().Get("difficulty"); difficulty != "" {
+			config = gameConfig.For(difficulty)
 		}
 
 		response := ConfigResponse{
-			Success: true,
-			Config:  config,
+			Success:      true,
+			Config:       &config,
+			Difficulties: gameConfig.Difficulties,
 		}
 
 		json.NewEncoder(w).Encode(response)
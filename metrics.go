@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Guesses per second is rate(prodle_guesses_total[1m]); counters only ever go up.
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "prodle_http_requests_total",
+		Help: "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prodle_http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	sessionsStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "prodle_sessions_started_total",
+		Help: "Game sessions started by difficulty.",
+	}, []string{"difficulty"})
+
+	sessionsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "prodle_sessions_completed_total",
+		Help: "Game sessions completed by difficulty.",
+	}, []string{"difficulty"})
+
+	guessesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "prodle_guesses_total",
+		Help: "Guesses made, by result (correct or wrong).",
+	}, []string{"result"})
+
+	scoreSubmissions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "prodle_score_submissions_total",
+		Help: "Scores saved to the leaderboard, by difficulty and status (accepted or pending_review).",
+	}, []string{"difficulty", "status"})
+
+	leaderboardQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prodle_leaderboard_query_duration_seconds",
+		Help:    "Leaderboard database query latency by query.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+
+	dbErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "prodle_db_errors_total",
+		Help: "Failed database statements by operation.",
+	}, []string{"operation"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "prodle_active_sessions",
+		Help: "Game sessions held in memory.",
+	}, func() float64 {
+		sessionMutex.RLock()
+		defer sessionMutex.RUnlock()
+		return float64(len(activeSessions))
+	})
+)
+
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+func observeLeaderboardQuery(query string, start time.Time) {
+	leaderboardQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+func countDBError(operation string, err error) {
+	if err != nil {
+		dbErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrumentHTTP records every request against the ServeMux pattern that served it, which keeps
+// label values bounded: /run/{id} is one route however many runs there are.
+func instrumentHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		method := r.Method
+		if !knownMethods[method] {
+			method = "other"
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		elapsed := time.Since(start)
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(route).Observe(elapsed.Seconds())
+
+		slog.DebugContext(r.Context(), "Request", "method", r.Method, "path", r.URL.Path, "route", route,
+			"status", status, "duration_ms", elapsed.Milliseconds())
+	})
+}
+
+// metricsHandler serves the Prometheus metrics, behind METRICS_TOKEN as a bearer token when it is set.
+func metricsHandler() http.HandlerFunc {
+	metrics := promhttp.Handler()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := os.Getenv("METRICS_TOKEN"); token != "" {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="prodle-metrics"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		metrics.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,691 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// Migrations run in order, each in its own transaction. Never edit an applied migration; add a new one.
+// Both backends share version numbers so a schema version means the same thing on either.
+var sqliteMigrations = []Migration{
+	{Version: 1, Name: "initial schema", Up: migrateInitialSchema},
+	{Version: 2, Name: "unified leaderboard", Up: migrateUnifiedLeaderboard},
+	{Version: 3, Name: "moderation", Up: migrateModeration},
+	{Version: 4, Name: "run suspicion", Up: migrateRunSuspicion},
+	{Version: 5, Name: "run transcripts", Up: migrateRunTranscripts},
+	{Version: 6, Name: "saved sessions", Up: migrateSavedSessions},
+	{Version: 7, Name: "hashed auth tokens", Up: migrateHashedAuthTokens},
+	{Version: 8, Name: "leaderboard date index", Up: migrateLeaderboardDateIndex},
+	{Version: 9, Name: "unique run entries", Up: migrateUniqueRunEntries},
+	{Version: 10, Name: "folded username bans", Up: migrateFoldedUsernameBans},
+	{Version: 11, Name: "folded account usernames", Up: migrateFoldedAccountUsernames},
+	{Version: 12, Name: "utc leaderboard dates", Up: migrateUTCLeaderboardDates},
+	{Version: 13, Name: "null run ids", Up: migrateNullRunIDs},
+	{Version: 14, Name: "hidden runs", Up: migrateHiddenRuns},
+}
+
+func (s *sqlStore) migrate(migrations []Migration) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);`
+
+	if _, err := s.exec(query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		if err := s.applyMigration(migration); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", migration.Version, migration.Name, err)
+		}
+
+		slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) applyMigration(migration Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := migration.Up(tx); err != nil {
+		return err
+	}
+
+	query := s.rebind(`
+	INSERT INTO schema_migrations (version, name, applied_at)
+	VALUES (?, ?, ?)`)
+
+	if _, err := tx.Exec(query, migration.Version, migration.Name, time.Now()); err != nil {
+		return fmt.Errorf("failed to record migration: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.queryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return version, nil
+}
+
+func tableExists(tx *sql.Tx, table string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s table: %v", table, err)
+	}
+	return count > 0, nil
+}
+
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return fmt.Errorf("failed to scan %s table info: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s table info: %v", table, err)
+	}
+
+	rows.Close()
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to add %s column to %s: %v", column, table, err)
+	}
+
+	return nil
+}
+
+// migrateInitialSchema brings databases created before migrations existed up to the same starting point as new ones.
+func migrateInitialSchema(tx *sql.Tx) error {
+
+	difficulties := []string{"facile", "moyen", "difficile"}
+
+	for _, difficulty := range difficulties {
+		leaderboardQuery := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS leaderboard_%s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			score INTEGER NOT NULL,
+			date DATETIME NOT NULL,
+			duration INTEGER NOT NULL,
+			guess_count INTEGER NOT NULL,
+			run_id TEXT,
+			account_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`, difficulty)
+
+		if _, err := tx.Exec(leaderboardQuery); err != nil {
+			return fmt.Errorf("failed to create leaderboard_%s table: %v", difficulty, err)
+		}
+
+		if err := addColumnIfMissing(tx, "leaderboard_"+difficulty, "run_id", "TEXT"); err != nil {
+			return err
+		}
+
+		if err := addColumnIfMissing(tx, "leaderboard_"+difficulty, "account_id", "INTEGER"); err != nil {
+			return err
+		}
+	}
+
+	legacyLeaderboardQuery := `
+	CREATE TABLE IF NOT EXISTS leaderboard (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		score INTEGER NOT NULL,
+		date DATETIME NOT NULL,
+		duration INTEGER NOT NULL,
+		guess_count INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(legacyLeaderboardQuery); err != nil {
+		return fmt.Errorf("failed to create leaderboard table: %v", err)
+	}
+
+	targetResultsQuery := `
+	CREATE TABLE IF NOT EXISTS target_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		difficulty TEXT NOT NULL,
+		player_id TEXT NOT NULL,
+		found BOOLEAN NOT NULL,
+		guesses TEXT NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(targetResultsQuery); err != nil {
+		return fmt.Errorf("failed to create target_results table: %v", err)
+	}
+
+	targetResultsIndexQuery := `
+	CREATE INDEX IF NOT EXISTS idx_target_results_player 
+	ON target_results(player_id);`
+
+	if _, err := tx.Exec(targetResultsIndexQuery); err != nil {
+		return fmt.Errorf("failed to create target_results index: %v", err)
+	}
+
+	runsQuery := `
+	CREATE TABLE IF NOT EXISTS runs (
+		id TEXT PRIMARY KEY,
+		difficulty TEXT NOT NULL,
+		score INTEGER NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		players_found INTEGER NOT NULL,
+		lineup TEXT NOT NULL,
+		targets TEXT NOT NULL,
+		player_id TEXT,
+		username TEXT,
+		account_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(runsQuery); err != nil {
+		return fmt.Errorf("failed to create runs table: %v", err)
+	}
+
+	for _, column := range []string{"player_id", "username"} {
+		if err := addColumnIfMissing(tx, "runs", column, "TEXT"); err != nil {
+			return err
+		}
+	}
+
+	if err := addColumnIfMissing(tx, "runs", "account_id", "INTEGER"); err != nil {
+		return err
+	}
+
+	accountsQuery := `
+	CREATE TABLE IF NOT EXISTS accounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(accountsQuery); err != nil {
+		return fmt.Errorf("failed to create accounts table: %v", err)
+	}
+
+	authSessionsQuery := `
+	CREATE TABLE IF NOT EXISTS auth_sessions (
+		token TEXT PRIMARY KEY,
+		account_id INTEGER NOT NULL REFERENCES accounts(id),
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(authSessionsQuery); err != nil {
+		return fmt.Errorf("failed to create auth_sessions table: %v", err)
+	}
+
+	return nil
+}
+
+// migrateUnifiedLeaderboard replaces the per-difficulty leaderboard tables and the legacy
+// leaderboard table with a single leaderboard_entries table keyed by difficulty and mode.
+func migrateUnifiedLeaderboard(tx *sql.Tx) error {
+	entriesQuery := `
+	CREATE TABLE leaderboard_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		difficulty TEXT NOT NULL,
+		mode TEXT NOT NULL DEFAULT 'classic',
+		username TEXT NOT NULL,
+		score INTEGER NOT NULL,
+		date DATETIME NOT NULL,
+		duration INTEGER NOT NULL,
+		guess_count INTEGER NOT NULL,
+		run_id TEXT,
+		account_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(entriesQuery); err != nil {
+		return fmt.Errorf("failed to create leaderboard_entries table: %v", err)
+	}
+
+	indexQueries := []string{
+		`CREATE INDEX idx_leaderboard_entries_score ON leaderboard_entries(difficulty, mode, score DESC, duration ASC);`,
+		`CREATE INDEX idx_leaderboard_entries_run ON leaderboard_entries(run_id);`,
+	}
+
+	for _, query := range indexQueries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to create leaderboard_entries index: %v", err)
+		}
+	}
+
+	for _, difficulty := range []string{"facile", "moyen", "difficile"} {
+		table := "leaderboard_" + difficulty
+		exists, err := tableExists(tx, table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		moveQuery := fmt.Sprintf(`
+		INSERT INTO leaderboard_entries (difficulty, mode, username, score, date, duration, guess_count, run_id, account_id, created_at)
+		SELECT ?, ?, username, score, date, duration, guess_count, run_id, account_id, created_at
+		FROM %s
+		ORDER BY id`, table)
+
+		if _, err := tx.Exec(moveQuery, difficulty, GameModeClassic); err != nil {
+			return fmt.Errorf("failed to move %s rows: %v", table, err)
+		}
+
+		if _, err := tx.Exec(`DROP TABLE ` + table); err != nil {
+			return fmt.Errorf("failed to drop %s table: %v", table, err)
+		}
+	}
+
+	exists, err := tableExists(tx, "leaderboard")
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		// The legacy table predates difficulties; its rows are filed under difficile and kept out of the rankings by their mode
+		moveQuery := `
+		INSERT INTO leaderboard_entries (difficulty, mode, username, score, date, duration, guess_count, created_at)
+		SELECT 'difficile', ?, username, score, date, duration, guess_count, created_at
+		FROM leaderboard
+		ORDER BY id`
+
+		if _, err := tx.Exec(moveQuery, GameModeLegacy); err != nil {
+			return fmt.Errorf("failed to move leaderboard rows: %v", err)
+		}
+
+		if _, err := tx.Exec(`DROP TABLE leaderboard`); err != nil {
+			return fmt.Errorf("failed to drop leaderboard table: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func migrateModeration(tx *sql.Tx) error {
+	queries := []struct {
+		table string
+		query string
+	}{
+		{"leaderboard_entries", `
+		ALTER TABLE leaderboard_entries ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
+		ALTER TABLE leaderboard_entries ADD COLUMN player_id TEXT;
+		ALTER TABLE leaderboard_entries ADD COLUMN ip TEXT;`},
+		{"accounts", `
+		ALTER TABLE accounts ADD COLUMN role TEXT NOT NULL DEFAULT 'player';`},
+		{"bans", `
+		CREATE TABLE bans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			value TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_by TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE UNIQUE INDEX idx_bans_kind_value ON bans(kind, value);`},
+		{"moderation_log", `
+		CREATE TABLE moderation_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		);`},
+	}
+
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query); err != nil {
+			return fmt.Errorf("failed to migrate %s table: %v", q.table, err)
+		}
+	}
+
+	return nil
+}
+
+func migrateRunSuspicion(tx *sql.Tx) error {
+	query := `
+	ALTER TABLE leaderboard_entries ADD COLUMN suspicion INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE leaderboard_entries ADD COLUMN suspicion_flags TEXT NOT NULL DEFAULT '';`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to add suspicion to leaderboard_entries: %v", err)
+	}
+
+	return nil
+}
+
+func migrateRunTranscripts(tx *sql.Tx) error {
+	query := `ALTER TABLE runs ADD COLUMN transcript TEXT NOT NULL DEFAULT '';`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to add transcript to runs: %v", err)
+	}
+
+	return nil
+}
+
+func migrateSavedSessions(tx *sql.Tx) error {
+	query := `
+	CREATE TABLE saved_sessions (
+		id TEXT PRIMARY KEY,
+		data TEXT NOT NULL,
+		saved_at DATETIME NOT NULL
+	);`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to create saved_sessions table: %v", err)
+	}
+
+	return nil
+}
+
+func migrateHashedAuthTokens(tx *sql.Tx) error {
+	return hashAuthTokens(tx, `UPDATE auth_sessions SET token = ? WHERE token = ?`)
+}
+
+// hashAuthTokens replaces the plaintext tokens of existing auth sessions with their hashes,
+// so nobody is logged out by the change.
+func hashAuthTokens(tx *sql.Tx, update string) error {
+	rows, err := tx.Query(`SELECT token FROM auth_sessions`)
+	if err != nil {
+		return fmt.Errorf("failed to read auth_sessions: %v", err)
+	}
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan auth_sessions row: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating auth_sessions rows: %v", err)
+	}
+
+	for _, token := range tokens {
+		if _, err := tx.Exec(update, hashAuthToken(token), token); err != nil {
+			return fmt.Errorf("failed to hash auth token: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateLeaderboardDateIndex serves the time-windowed leaderboards, which filter on date.
+func migrateLeaderboardDateIndex(tx *sql.Tx) error {
+	query := `CREATE INDEX idx_leaderboard_entries_date ON leaderboard_entries(difficulty, mode, date);`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to create leaderboard date index: %v", err)
+	}
+
+	return nil
+}
+
+// migrateUniqueRunEntries allows one leaderboard entry per run. Runs submitted several times
+// keep their first entry, and the run's owner goes back to that entry's name.
+func migrateUniqueRunEntries(tx *sql.Tx) error {
+	queries := []string{
+		`DELETE FROM leaderboard_entries
+		WHERE run_id <> '' AND id NOT IN (
+			SELECT MIN(id) FROM leaderboard_entries WHERE run_id <> '' GROUP BY run_id
+		);`,
+		`UPDATE runs SET username = (
+			SELECT username FROM leaderboard_entries WHERE leaderboard_entries.run_id = runs.id
+		)
+		WHERE id IN (SELECT run_id FROM leaderboard_entries);`,
+		`DROP INDEX idx_leaderboard_entries_run;`,
+		`CREATE UNIQUE INDEX idx_leaderboard_entries_run ON leaderboard_entries(run_id) WHERE run_id <> '';`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to make leaderboard runs unique: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func migrateFoldedUsernameBans(tx *sql.Tx) error {
+	return foldUsernameBans(tx, `UPDATE bans SET value = ? WHERE id = ?`, `DELETE FROM bans WHERE id = ?`)
+}
+
+// foldUsernameBans rewrites username bans in the folded form they are now matched on. Bans that fold
+// to the same name are merged, keeping the one already folded or else the oldest.
+func foldUsernameBans(tx *sql.Tx, update, remove string) error {
+	rows, err := tx.Query(`SELECT id, value FROM bans WHERE kind = 'username' ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to read bans: %v", err)
+	}
+
+	type ban struct {
+		id     int64
+		value  string
+		folded string
+	}
+	var bans []ban
+	for rows.Next() {
+		var b ban
+		if err := rows.Scan(&b.id, &b.value); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan bans row: %v", err)
+		}
+		// A ban with nothing left to fold can match nobody either way, so it stays as it is
+		if b.folded = foldUsername(b.value); b.folded != "" {
+			bans = append(bans, b)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating bans rows: %v", err)
+	}
+
+	kept := make(map[string]ban)
+	for _, b := range bans {
+		if previous, ok := kept[b.folded]; !ok || (b.value == b.folded && previous.value != previous.folded) {
+			kept[b.folded] = b
+		}
+	}
+
+	// Merged bans go first, so no update collides with a value about to be removed.
+	for _, b := range bans {
+		if kept[b.folded] != b {
+			if _, err := tx.Exec(remove, b.id); err != nil {
+				return fmt.Errorf("failed to merge ban %d: %v", b.id, err)
+			}
+		}
+	}
+
+	for _, b := range kept {
+		if b.value == b.folded {
+			continue
+		}
+		if _, err := tx.Exec(update, b.folded, b.id); err != nil {
+			return fmt.Errorf("failed to fold ban %d: %v", b.id, err)
+		}
+	}
+
+	return nil
+}
+
+func migrateFoldedAccountUsernames(tx *sql.Tx) error {
+	return foldAccountUsernames(tx, `UPDATE accounts SET folded_username = ? WHERE id = ?`)
+}
+
+// foldAccountUsernames stores each account name in the folded form anonymous names are checked
+// against, so a lookalike cannot pass for a registered player. When existing accounts fold to the
+// same name the oldest keeps it; the others stay reserved through it.
+func foldAccountUsernames(tx *sql.Tx, update string) error {
+	if _, err := tx.Exec(`ALTER TABLE accounts ADD COLUMN folded_username TEXT;`); err != nil {
+		return fmt.Errorf("failed to add folded_username column: %v", err)
+	}
+
+	rows, err := tx.Query(`SELECT id, username FROM accounts ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to read accounts: %v", err)
+	}
+
+	type account struct {
+		id       int64
+		username string
+	}
+	var accounts []account
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.id, &a.username); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan accounts row: %v", err)
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating accounts rows: %v", err)
+	}
+
+	owners := make(map[string]string)
+	for _, a := range accounts {
+		folded := foldUsername(a.username)
+		if folded == "" {
+			continue
+		}
+		if owner, ok := owners[folded]; ok {
+			slog.Warn("Account name folds to the same as an older account", "account", a.username, "older", owner)
+			continue
+		}
+		owners[folded] = a.username
+
+		if _, err := tx.Exec(update, folded, a.id); err != nil {
+			return fmt.Errorf("failed to fold account %d: %v", a.id, err)
+		}
+	}
+
+	if _, err := tx.Exec(`CREATE UNIQUE INDEX idx_accounts_folded_username ON accounts(folded_username);`); err != nil {
+		return fmt.Errorf("failed to create folded username index: %v", err)
+	}
+
+	return nil
+}
+
+// migrateUTCLeaderboardDates rewrites leaderboard dates in UTC. SQLite keeps them as text with the
+// offset they were written with, so dates from either side of a DST change, or imported in UTC,
+// did not compare in time order.
+func migrateUTCLeaderboardDates(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, date FROM leaderboard_entries`)
+	if err != nil {
+		return fmt.Errorf("failed to read leaderboard dates: %v", err)
+	}
+
+	dates := make(map[int64]time.Time)
+	for rows.Next() {
+		var id int64
+		var date time.Time
+		if err := rows.Scan(&id, &date); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan leaderboard_entries row: %v", err)
+		}
+		dates[id] = date
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating leaderboard_entries rows: %v", err)
+	}
+
+	for id, date := range dates {
+		if _, err := tx.Exec(`UPDATE leaderboard_entries SET date = ? WHERE id = ?`, date.UTC(), id); err != nil {
+			return fmt.Errorf("failed to rewrite date of entry %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateNullRunIDs stores entries without a run with a NULL run_id, as imports already did, and
+// keeps them out of the one-entry-per-run index.
+func migrateNullRunIDs(tx *sql.Tx) error {
+	queries := []string{
+		`UPDATE leaderboard_entries SET run_id = NULL WHERE run_id = '';`,
+		`DROP INDEX idx_leaderboard_entries_run;`,
+		`CREATE UNIQUE INDEX idx_leaderboard_entries_run ON leaderboard_entries(run_id) WHERE run_id IS NOT NULL;`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to clear empty run ids: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateHiddenRuns keeps runs off profiles while they are off the leaderboard. Runs whose entry is
+// hidden start hidden, as do runs with an owner but no entry, which a moderator deleted.
+func migrateHiddenRuns(tx *sql.Tx) error {
+	queries := []string{
+		`ALTER TABLE runs ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`UPDATE runs SET hidden = TRUE WHERE id IN (SELECT run_id FROM leaderboard_entries WHERE hidden);`,
+		`UPDATE runs SET hidden = TRUE
+		WHERE username IS NOT NULL AND username <> ''
+			AND id NOT IN (SELECT run_id FROM leaderboard_entries WHERE run_id IS NOT NULL);`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to add hidden runs: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+var postgresMigrations = []Migration{
+	{Version: 1, Name: "initial schema", Up: migratePostgresInitialSchema},
+	{Version: 2, Name: "unified leaderboard", Up: migratePostgresUnifiedLeaderboard},
+	{Version: 3, Name: "moderation", Up: migratePostgresModeration},
+	{Version: 4, Name: "run suspicion", Up: migrateRunSuspicion},
+	{Version: 5, Name: "run transcripts", Up: migrateRunTranscripts},
+	{Version: 6, Name: "saved sessions", Up: migratePostgresSavedSessions},
+	{Version: 7, Name: "hashed auth tokens", Up: migratePostgresHashedAuthTokens},
+	{Version: 8, Name: "leaderboard date index", Up: migrateLeaderboardDateIndex},
+	{Version: 9, Name: "unique run entries", Up: migrateUniqueRunEntries},
+	{Version: 10, Name: "folded username bans", Up: migratePostgresFoldedUsernameBans},
+	{Version: 11, Name: "folded account usernames", Up: migratePostgresFoldedAccountUsernames},
+	{Version: 12, Name: "utc leaderboard dates", Up: migratePostgresUTCLeaderboardDates},
+	{Version: 13, Name: "null run ids", Up: migrateNullRunIDs},
+	{Version: 14, Name: "hidden runs", Up: migrateHiddenRuns},
+}
+
+// PostgreSQL databases start without the per-difficulty leaderboard tables SQLite had to carry.
+func migratePostgresInitialSchema(tx *sql.Tx) error {
+	queries := []struct {
+		table string
+		query string
+	}{
+		{"target_results", `
+		CREATE TABLE target_results (
+			id BIGSERIAL PRIMARY KEY,
+			session_id TEXT NOT NULL,
+			difficulty TEXT NOT NULL,
+			player_id TEXT NOT NULL,
+			found BOOLEAN NOT NULL,
+			guesses TEXT NOT NULL,
+			start_time TIMESTAMPTZ NOT NULL,
+			end_time TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX idx_target_results_player ON target_results(player_id);`},
+		{"runs", `
+		CREATE TABLE runs (
+			id TEXT PRIMARY KEY,
+			difficulty TEXT NOT NULL,
+			score INTEGER NOT NULL,
+			start_time TIMESTAMPTZ NOT NULL,
+			end_time TIMESTAMPTZ NOT NULL,
+			players_found INTEGER NOT NULL,
+			lineup TEXT NOT NULL,
+			targets TEXT NOT NULL,
+			player_id TEXT,
+			username TEXT,
+			account_id BIGINT,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`},
+		{"accounts", `
+		CREATE TABLE accounts (
+			id BIGSERIAL PRIMARY KEY,
+			username TEXT NOT NULL,
+			password_hash TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX idx_accounts_username ON accounts(lower(username));`},
+		{"auth_sessions", `
+		CREATE TABLE auth_sessions (
+			token TEXT PRIMARY KEY,
+			account_id BIGINT NOT NULL REFERENCES accounts(id),
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`},
+	}
+
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query); err != nil {
+			return fmt.Errorf("failed to create %s table: %v", q.table, err)
+		}
+	}
+
+	return nil
+}
+
+func migratePostgresUnifiedLeaderboard(tx *sql.Tx) error {
+	query := `
+	CREATE TABLE leaderboard_entries (
+		id BIGSERIAL PRIMARY KEY,
+		difficulty TEXT NOT NULL,
+		mode TEXT NOT NULL DEFAULT 'classic',
+		username TEXT NOT NULL,
+		score INTEGER NOT NULL,
+		date TIMESTAMPTZ NOT NULL,
+		duration INTEGER NOT NULL,
+		guess_count INTEGER NOT NULL,
+		run_id TEXT,
+		account_id BIGINT,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_leaderboard_entries_score ON leaderboard_entries(difficulty, mode, score DESC, duration ASC);
+	CREATE INDEX idx_leaderboard_entries_run ON leaderboard_entries(run_id);`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to create leaderboard_entries table: %v", err)
+	}
+
+	return nil
+}
+
+func migratePostgresModeration(tx *sql.Tx) error {
+	queries := []struct {
+		table string
+		query string
+	}{
+		{"leaderboard_entries", `
+		ALTER TABLE leaderboard_entries
+			ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN player_id TEXT,
+			ADD COLUMN ip TEXT;`},
+		{"accounts", `
+		ALTER TABLE accounts ADD COLUMN role TEXT NOT NULL DEFAULT 'player';`},
+		{"bans", `
+		CREATE TABLE bans (
+			id BIGSERIAL PRIMARY KEY,
+			kind TEXT NOT NULL,
+			value TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_by TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE UNIQUE INDEX idx_bans_kind_value ON bans(kind, value);`},
+		{"moderation_log", `
+		CREATE TABLE moderation_log (
+			id BIGSERIAL PRIMARY KEY,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL
+		);`},
+	}
+
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query); err != nil {
+			return fmt.Errorf("failed to migrate %s table: %v", q.table, err)
+		}
+	}
+
+	return nil
+}
+
+func migratePostgresSavedSessions(tx *sql.Tx) error {
+	query := `
+	CREATE TABLE saved_sessions (
+		id TEXT PRIMARY KEY,
+		data TEXT NOT NULL,
+		saved_at TIMESTAMPTZ NOT NULL
+	);`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to create saved_sessions table: %v", err)
+	}
+
+	return nil
+}
+
+func migratePostgresHashedAuthTokens(tx *sql.Tx) error {
+	return hashAuthTokens(tx, `UPDATE auth_sessions SET token = $1 WHERE token = $2`)
+}
+
+func migratePostgresFoldedUsernameBans(tx *sql.Tx) error {
+	return foldUsernameBans(tx, `UPDATE bans SET value = $1 WHERE id = $2`, `DELETE FROM bans WHERE id = $1`)
+}
+
+func migratePostgresFoldedAccountUsernames(tx *sql.Tx) error {
+	return foldAccountUsernames(tx, `UPDATE accounts SET folded_username = $1 WHERE id = $2`)
+}
+
+// TIMESTAMPTZ already compares instants, so PostgreSQL dates need no rewriting.
+func migratePostgresUTCLeaderboardDates(tx *sql.Tx) error {
+	return nil
+}
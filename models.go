@@ -60,22 +60,103 @@ type GuessResult struct {
 	IsCorrect     bool                        `json:"is_correct"`
 }
 
+type TargetOutcome string
+
+const (
+	TargetPending  TargetOutcome = "pending"
+	TargetFound    TargetOutcome = "found"
+	TargetMissed   TargetOutcome = "missed"
+	TargetUnplayed TargetOutcome = "unplayed"
+)
+
+type TargetAttempt struct {
+	PlayerID  string        `json:"player_id"`
+	Guesses   []GuessResult `json:"guesses"`
+	StartTime time.Time     `json:"start_time"`
+	EndTime   *time.Time    `json:"end_time,omitempty"`
+	Outcome   TargetOutcome `json:"outcome"`
+}
+
 type GameSession struct {
-	SessionID          string        `json:"session_id"`
-	Difficulty         string        `json:"difficulty"`
-	SelectedPlayers    []Player      `json:"selected_players"`
-	CurrentPlayerIndex int           `json:"current_player_index"`
-	Score              int           `json:"score"`
-	StartTime          time.Time     `json:"start_time"`
-	Guesses            []GuessResult `json:"guesses"`
-	IsCompleted        bool          `json:"is_completed"`
-	CompletionTime     *time.Time    `json:"completion_time,omitempty"`
+	SessionID          string          `json:"session_id"`
+	Difficulty         string          `json:"difficulty"`
+	Settings           GameSettings    `json:"settings"`
+	SelectedPlayers    []Player        `json:"selected_players"`
+	CurrentPlayerIndex int             `json:"current_player_index"`
+	Score              int             `json:"score"`
+	StartTime          time.Time       `json:"start_time"`
+	Targets            []TargetAttempt `json:"targets"`
+	RunID              string          `json:"run_id,omitempty"`
+	PlayerID           string          `json:"-"`
+	AccountID          int64           `json:"-"`
+	IsCompleted        bool            `json:"is_completed"`
+	CompletionTime     *time.Time      `json:"completion_time,omitempty"`
+	AutocompleteTimes  []time.Time     `json:"-"`
+	Analysis           *RunAnalysis    `json:"-"`
 }
 
+// Legacy entries predate difficulties and are kept out of the ranked leaderboards.
+const (
+	GameModeClassic = "classic"
+	GameModeLegacy  = "legacy"
+)
+
 type LeaderboardEntry struct {
+	ID         int64     `json:"id,omitempty"`
+	Difficulty string    `json:"difficulty,omitempty"`
+	Mode       string    `json:"mode,omitempty"`
 	Username   string    `json:"username"`
 	Score      int       `json:"score"`
 	Date       time.Time `json:"date"`
 	Duration   int       `json:"duration"`
 	GuessCount int       `json:"guess_count"`
+	RunID      string    `json:"run_id,omitempty"`
+	AccountID  int64     `json:"account_id,omitempty"`
+	RunCount   int       `json:"run_count,omitempty"`
+	Rank       int       `json:"rank,omitempty"`
+	Hidden     bool      `json:"hidden,omitempty"`
+	Suspicion  int       `json:"suspicion,omitempty"`
+	Flags      string    `json:"suspicion_flags,omitempty"`
+	PlayerID   string    `json:"-"`
+	IP         string    `json:"-"`
+}
+
+type Account struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Run struct {
+	ID            string          `json:"id"`
+	Difficulty    string          `json:"difficulty"`
+	Score         int             `json:"score"`
+	StartTime     time.Time       `json:"start_time"`
+	EndTime       time.Time       `json:"end_time"`
+	PlayersFound  int             `json:"players_found"`
+	Lineup        []string        `json:"lineup"`
+	Targets       []TargetAttempt `json:"targets"`
+	PlayerID      string          `json:"-"`
+	Username      string          `json:"username,omitempty"`
+	AccountID     int64           `json:"account_id,omitempty"`
+	Transcript    []byte          `json:"-"`
+	HasTranscript bool            `json:"-"`
+	Hidden        bool            `json:"-"`
+}
+
+type TargetGuess struct {
+	PlayerID string   `json:"player_id"`
+	Exact    []string `json:"exact"`
+}
+
+type TargetResult struct {
+	SessionID  string        `json:"session_id"`
+	Difficulty string        `json:"difficulty"`
+	PlayerID   string        `json:"player_id"`
+	Found      bool          `json:"found"`
+	Guesses    []TargetGuess `json:"guesses"`
+	StartTime  time.Time     `json:"start_time"`
+	EndTime    time.Time     `json:"end_time"`
 }
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	AccountRolePlayer = "player"
+	AccountRoleAdmin  = "admin"
+)
+
+const (
+	BanUsername = "username"
+	BanIP       = "ip"
+)
+
+type Ban struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ModerationAction struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// normalizeBanValue stores username bans folded like the username policy compares names, so a
+// lookalike spelling ("B0b", "Воb") of a banned name is banned too.
+func normalizeBanValue(kind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("ban value cannot be empty")
+	}
+
+	switch kind {
+	case BanUsername:
+		folded := foldUsername(value)
+		if folded == "" {
+			return "", fmt.Errorf("username ban must contain a letter or a digit")
+		}
+		return folded, nil
+	case BanIP:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", fmt.Errorf("invalid IP address: %s", value)
+		}
+		return ip.String(), nil
+	}
+
+	return "", fmt.Errorf("invalid ban kind: %s", kind)
+}
+
+// moderate applies a change and records it in the moderation log in the same transaction,
+// so no change goes unaudited. It reports whether the change matched anything.
+func (s *sqlStore) moderate(action ModerationAction, query string, args ...interface{}) (bool, error) {
+	return s.moderateWith(action, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec(s.rebind(query), args...)
+	})
+}
+
+// moderateWith is moderate for changes spanning several statements. The result of apply tells
+// whether the change matched anything.
+func (s *sqlStore) moderateWith(action ModerationAction, apply func(tx *sql.Tx) (sql.Result, error)) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin moderation: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := apply(tx)
+	if err != nil {
+		return false, fmt.Errorf("failed to %s %s: %v", action.Action, action.Target, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to %s %s: %v", action.Action, action.Target, err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if err := s.recordModeration(tx, action); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit moderation action: %v", err)
+	}
+
+	return true, nil
+}
+
+func (s *sqlStore) recordModeration(tx *sql.Tx, action ModerationAction) error {
+	query := s.rebind(`
+	INSERT INTO moderation_log (actor, action, target, details, created_at)
+	VALUES (?, ?, ?, ?, ?)`)
+
+	if _, err := tx.Exec(query, action.Actor, action.Action, action.Target, action.Details, time.Now()); err != nil {
+		return fmt.Errorf("failed to record moderation action: %v", err)
+	}
+	return nil
+}
+
+const moderationEntryColumns = `id, difficulty, mode, username, score, date, duration, guess_count,
+	COALESCE(run_id, ''), COALESCE(account_id, 0), COALESCE(player_id, ''), COALESCE(ip, ''), hidden, suspicion, suspicion_flags`
+
+func scanModerationEntry(row rowScanner) (*LeaderboardEntry, error) {
+	var entry LeaderboardEntry
+	err := row.Scan(
+		&entry.ID,
+		&entry.Difficulty,
+		&entry.Mode,
+		&entry.Username,
+		&entry.Score,
+		&entry.Date,
+		&entry.Duration,
+		&entry.GuessCount,
+		&entry.RunID,
+		&entry.AccountID,
+		&entry.PlayerID,
+		&entry.IP,
+		&entry.Hidden,
+		&entry.Suspicion,
+		&entry.Flags,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetRecentLeaderboardEntries lists submissions newest first, hidden and legacy ones included.
+func (s *sqlStore) GetRecentLeaderboardEntries(offset, limit int) ([]LeaderboardEntry, error) {
+	query := `SELECT ` + moderationEntryColumns + ` FROM leaderboard_entries ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	rows, err := s.query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent leaderboard entries: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		entry, err := scanModerationEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard entry: %v", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating leaderboard entries: %v", err)
+	}
+
+	return entries, nil
+}
+
+func (s *sqlStore) GetLeaderboardEntry(id int64) (*LeaderboardEntry, error) {
+	query := `SELECT ` + moderationEntryColumns + ` FROM leaderboard_entries WHERE id = ?`
+
+	entry, err := scanModerationEntry(s.queryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query leaderboard entry %d: %v", id, err)
+	}
+
+	return entry, nil
+}
+
+// setEntryRunHidden hides the run behind an entry from profiles along with the entry, so a run kept
+// off the leaderboard does not show up as a personal best instead.
+func (s *sqlStore) setEntryRunHidden(tx *sql.Tx, id int64, hidden bool) error {
+	query := s.rebind(`UPDATE runs SET hidden = ? WHERE id = (SELECT run_id FROM leaderboard_entries WHERE id = ?)`)
+	_, err := tx.Exec(query, hidden, id)
+	return err
+}
+
+func (s *sqlStore) SetLeaderboardEntryHidden(id int64, hidden bool, action ModerationAction) (bool, error) {
+	return s.moderateWith(action, func(tx *sql.Tx) (sql.Result, error) {
+		if err := s.setEntryRunHidden(tx, id, hidden); err != nil {
+			return nil, err
+		}
+		return tx.Exec(s.rebind(`UPDATE leaderboard_entries SET hidden = ? WHERE id = ?`), hidden, id)
+	})
+}
+
+func (s *sqlStore) DeleteLeaderboardEntry(id int64, action ModerationAction) (bool, error) {
+	return s.moderateWith(action, func(tx *sql.Tx) (sql.Result, error) {
+		if err := s.setEntryRunHidden(tx, id, true); err != nil {
+			return nil, err
+		}
+		return tx.Exec(s.rebind(`DELETE FROM leaderboard_entries WHERE id = ?`), id)
+	})
+}
+
+// AddBan bans a username or IP, replacing the reason if it is already banned.
+func (s *sqlStore) AddBan(ban Ban, action ModerationAction) error {
+	query := `
+	INSERT INTO bans (kind, value, reason, created_by, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (kind, value) DO UPDATE SET reason = excluded.reason`
+
+	_, err := s.moderate(action, query, ban.Kind, ban.Value, ban.Reason, ban.CreatedBy, time.Now())
+	return err
+}
+
+func (s *sqlStore) RemoveBan(kind, value string, action ModerationAction) (bool, error) {
+	return s.moderate(action, `DELETE FROM bans WHERE kind = ? AND value = ?`, kind, value)
+}
+
+func (s *sqlStore) GetBans() ([]Ban, error) {
+	rows, err := s.query(`
+	SELECT id, kind, value, reason, created_by, created_at
+	FROM bans
+	ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bans: %v", err)
+	}
+	defer rows.Close()
+
+	var bans []Ban
+	for rows.Next() {
+		var ban Ban
+		if err := rows.Scan(&ban.ID, &ban.Kind, &ban.Value, &ban.Reason, &ban.CreatedBy, &ban.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ban: %v", err)
+		}
+		bans = append(bans, ban)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bans: %v", err)
+	}
+
+	return bans, nil
+}
+
+func (s *sqlStore) IsBanned(username, ip string) (bool, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM bans
+	WHERE (kind = ? AND value = ?) OR (kind = ? AND value = ?)`
+
+	var count int
+	if err := s.queryRow(query, BanUsername, foldUsername(username), BanIP, ip).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check bans: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *sqlStore) SetAccountRole(username, role string, action ModerationAction) (bool, error) {
+	return s.moderate(action, `UPDATE accounts SET role = ? WHERE lower(username) = lower(?)`, role, username)
+}
+
+func (s *sqlStore) GetModerationLog(limit int) ([]ModerationAction, error) {
+	rows, err := s.query(`
+	SELECT id, actor, action, target, details, created_at
+	FROM moderation_log
+	ORDER BY id DESC
+	LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query moderation log: %v", err)
+	}
+	defer rows.Close()
+
+	var actions []ModerationAction
+	for rows.Next() {
+		var action ModerationAction
+		if err := rows.Scan(&action.ID, &action.Actor, &action.Action, &action.Target, &action.Details, &action.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan moderation action: %v", err)
+		}
+		actions = append(actions, action)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating moderation log: %v", err)
+	}
+
+	return actions, nil
+}
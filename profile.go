@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	playerCookieName     = "prodle_player"
+	playerCookieDuration = 365 * 24 * time.Hour
+	profileTrendLength   = 50
+	profileMissedTargets = 5
+)
+
+type PersonalBest struct {
+	Difficulty    string `json:"difficulty"`
+	Score         int    `json:"score"`
+	RunID         string `json:"run_id"`
+	FormattedDate string `json:"formatted_date"`
+}
+
+type ScorePoint struct {
+	RunID      string    `json:"run_id"`
+	Difficulty string    `json:"difficulty"`
+	Score      int       `json:"score"`
+	Date       time.Time `json:"date"`
+}
+
+type Profile struct {
+	Name                string         `json:"name"`
+	Verified            bool           `json:"verified"`
+	TotalRuns           int            `json:"total_runs"`
+	PersonalBests       []PersonalBest `json:"personal_bests"`
+	AveragePlayersFound float64        `json:"average_players_found"`
+	ScoreTrend          []ScorePoint   `json:"score_trend"`
+	FavouriteDifficulty string         `json:"favourite_difficulty"`
+	MostMissedTargets   []GuessCount   `json:"most_missed_targets"`
+}
+
+type ProfileResponse struct {
+	Success bool     `json:"success"`
+	Message string   `json:"message,omitempty"`
+	Profile *Profile `json:"profile,omitempty"`
+}
+
+// CurrentPlayerID returns the anonymous player identity stored in the browser, if any.
+func CurrentPlayerID(r *http.Request) string {
+	cookie, err := r.Cookie(playerCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// EnsurePlayerID returns the browser's anonymous player identity, issuing one on first visit.
+func EnsurePlayerID(w http.ResponseWriter, r *http.Request) string {
+	if playerID := CurrentPlayerID(r); playerID != "" {
+		return playerID
+	}
+
+	playerID, err := generateSessionID()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating player ID", "error", err)
+		return ""
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     playerCookieName,
+		Value:    playerID,
+		Path:     "/",
+		Expires:  time.Now().Add(playerCookieDuration),
+		HttpOnly: true,
+		Secure:   secureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return playerID
+}
+
+func BuildProfile(name string, verified bool, runs []Run) Profile {
+	profile := Profile{
+		Name:              name,
+		Verified:          verified,
+		TotalRuns:         len(runs),
+		PersonalBests:     []PersonalBest{},
+		ScoreTrend:        []ScorePoint{},
+		MostMissedTargets: []GuessCount{},
+	}
+
+	if len(runs) == 0 {
+		return profile
+	}
+
+	bests := make(map[string]Run)
+	runsPerDifficulty := make(map[string]int)
+	missed := make(map[string]int)
+	totalFound := 0
+
+	for _, run := range runs {
+		totalFound += run.PlayersFound
+		runsPerDifficulty[run.Difficulty]++
+
+		if best, exists := bests[run.Difficulty]; !exists || run.Score > best.Score {
+			bests[run.Difficulty] = run
+		}
+
+		for _, target := range run.Targets {
+			if target.Outcome == TargetMissed {
+				missed[target.PlayerID]++
+			}
+		}
+
+		profile.ScoreTrend = append(profile.ScoreTrend, ScorePoint{
+			RunID:      run.ID,
+			Difficulty: run.Difficulty,
+			Score:      run.Score,
+			Date:       run.EndTime,
+		})
+	}
+
+	profile.AveragePlayersFound = float64(totalFound) / float64(len(runs))
+
+	if len(profile.ScoreTrend) > profileTrendLength {
+		profile.ScoreTrend = profile.ScoreTrend[len(profile.ScoreTrend)-profileTrendLength:]
+	}
+
+	for _, difficulty := range leaderboardDifficulties {
+		if best, exists := bests[difficulty]; exists {
+			profile.PersonalBests = append(profile.PersonalBests, PersonalBest{
+				Difficulty:    difficulty,
+				Score:         best.Score,
+				RunID:         best.ID,
+				FormattedDate: best.EndTime.Format("Jan 2, 2006"),
+			})
+		}
+
+		if runsPerDifficulty[difficulty] > runsPerDifficulty[profile.FavouriteDifficulty] {
+			profile.FavouriteDifficulty = difficulty
+		}
+	}
+
+	for playerID, count := range missed {
+		profile.MostMissedTargets = append(profile.MostMissedTargets, GuessCount{PlayerID: playerID, Count: count})
+	}
+	sort.Slice(profile.MostMissedTargets, func(i, j int) bool {
+		if profile.MostMissedTargets[i].Count != profile.MostMissedTargets[j].Count {
+			return profile.MostMissedTargets[i].Count > profile.MostMissedTargets[j].Count
+		}
+		return profile.MostMissedTargets[i].PlayerID < profile.MostMissedTargets[j].PlayerID
+	})
+	if len(profile.MostMissedTargets) > profileMissedTargets {
+		profile.MostMissedTargets = profile.MostMissedTargets[:profileMissedTargets]
+	}
+
+	return profile
+}
+
+// loadProfile resolves /profile/{name}; without a name it shows the visitor's own runs.
+func loadProfile(r *http.Request) (*Profile, error) {
+	name := strings.TrimSpace(r.PathValue("name"))
+
+	if name == "" {
+		if account := CurrentAccount(r); account != nil {
+			name = account.Username
+		} else {
+			playerID := CurrentPlayerID(r)
+			if playerID == "" {
+				return nil, nil
+			}
+
+			runs, err := store.GetRunsByPlayerID(playerID)
+			if err != nil {
+				return nil, err
+			}
+
+			profile := BuildProfile("Moi", false, runs)
+			return &profile, nil
+		}
+	}
+
+	account, err := store.GetAccountByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	if account != nil {
+		runs, err = store.GetRunsByAccount(account.ID)
+		name = account.Username
+	} else {
+		runs, err = store.GetRunsByUsername(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if account == nil && len(runs) == 0 {
+		return nil, nil
+	}
+
+	profile := BuildProfile(name, account != nil, runs)
+	return &profile, nil
+}
+
+// scoreTrendPoints lays the trend out as SVG polyline coordinates in a width x height box.
+func scoreTrendPoints(trend []ScorePoint, width, height int) string {
+	if len(trend) == 0 {
+		return ""
+	}
+
+	maxScore := 1
+	for _, point := range trend {
+		if point.Score > maxScore {
+			maxScore = point.Score
+		}
+	}
+
+	points := make([]string, len(trend))
+	for i, point := range trend {
+		x := 0
+		if len(trend) > 1 {
+			x = i * width / (len(trend) - 1)
+		}
+		y := height - point.Score*height/maxScore
+		points[i] = fmt.Sprintf("%d,%d", x, y)
+	}
+
+	return strings.Join(points, " ")
+}
+
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profile, err := loadProfile(r)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading profile", "error", err)
+		return
+	}
+
+	if profile == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		Profile     *Profile
+		TrendPoints string
+	}{
+		Profile:     profile,
+		TrendPoints: scoreTrendPoints(profile.ScoreTrend, 600, 150),
+	}
+
+	err = templates.ExecuteTemplate(w, "profile.html", data)
+	if err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template error", "template", "profile.html", "error", err)
+	}
+}
+
+func profileAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	profile, err := loadProfile(r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error loading profile", "error", err)
+		response := ProfileResponse{
+			Success: false,
+			Message: "Failed to load profile",
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if profile == nil {
+		response := ProfileResponse{
+			Success: false,
+			Message: "Profile not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := ProfileResponse{
+		Success: true,
+		Profile: profile,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitRoute = "api"
+	maxSessionPeekSize    = 4 << 10
+	rateLimitPruneEvery   = time.Minute
+)
+
+// RateLimitRule lets Burst requests through at once, refilling at Rate requests per second.
+type RateLimitRule struct {
+	Rate  float64
+	Burst int
+}
+
+type RateLimitResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// Rules are named route.key, where key is ip or session. Routes without their own ip rule use api.ip.
+var defaultRateLimits = map[string]RateLimitRule{
+	"api.ip":               {Rate: 2, Burst: 60},
+	"start-game.ip":        {Rate: 10.0 / 60, Burst: 5},
+	"guess.ip":             {Rate: 3, Burst: 30},
+	"guess.session":        {Rate: 1, Burst: 10},
+	"autocomplete.ip":      {Rate: 10, Burst: 40},
+	"end-game.session":     {Rate: 1, Burst: 3},
+	"submit-score.ip":      {Rate: 10.0 / 60, Burst: 5},
+	"submit-score.session": {Rate: 1.0 / 60, Burst: 3},
+	"register.ip":          {Rate: 5.0 / 3600, Burst: 5},
+	"login.ip":             {Rate: 10.0 / 60, Burst: 5},
+	"admin.ip":             {Rate: 1, Burst: 30},
+}
+
+var rateLimitUnits = map[string]float64{"s": 1, "m": 60, "h": 3600}
+
+// parseRateLimitRule reads "30/m:10", 30 requests a minute with bursts of 10. The burst defaults to the
+// per-unit count. "off" disables the rule.
+func parseRateLimitRule(value string) (*RateLimitRule, error) {
+	if value == "off" {
+		return nil, nil
+	}
+
+	spec, burstValue, hasBurst := strings.Cut(value, ":")
+	countValue, unit, ok := strings.Cut(spec, "/")
+	seconds, known := rateLimitUnits[unit]
+	count, err := strconv.Atoi(countValue)
+	if !ok || !known || err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid rate %q, use count/unit[:burst] with unit s, m or h", value)
+	}
+
+	rule := &RateLimitRule{Rate: float64(count) / seconds, Burst: count}
+	if hasBurst {
+		burst, err := strconv.Atoi(burstValue)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid burst in %q", value)
+		}
+		rule.Burst = burst
+	}
+
+	return rule, nil
+}
+
+// LoadRateLimitRules applies RATE_LIMITS overrides on top of the defaults,
+// e.g. RATE_LIMITS="guess.session=30/m:10,start-game.ip=off".
+func LoadRateLimitRules() (map[string]*RateLimitRule, error) {
+	rules := make(map[string]*RateLimitRule, len(defaultRateLimits))
+	for name, rule := range defaultRateLimits {
+		rules[name] = &rule
+	}
+
+	for _, entry := range strings.Split(os.Getenv("RATE_LIMITS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, "=")
+		route, key, validName := strings.Cut(strings.TrimSpace(name), ".")
+		if !ok || !validName || route == "" || (key != "ip" && key != "session") {
+			return nil, fmt.Errorf("invalid RATE_LIMITS entry %q, use route.ip=rate or route.session=rate", entry)
+		}
+
+		rule, err := parseRateLimitRule(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMITS %s: %v", name, err)
+		}
+		rules[strings.TrimSpace(name)] = rule
+	}
+
+	return rules, nil
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type RateLimiter struct {
+	rule    RateLimitRule
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func NewRateLimiter(rule RateLimitRule) *RateLimiter {
+	return &RateLimiter{rule: rule, buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow takes a token from key's bucket, or reports how long until one is available.
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(l.rule.Burst), updated: now}
+		l.buckets[key] = bucket
+	} else {
+		bucket.tokens = math.Min(float64(l.rule.Burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rule.Rate)
+		bucket.updated = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - bucket.tokens) / l.rule.Rate * float64(time.Second))
+}
+
+// prune forgets buckets that have refilled, since a fresh bucket behaves the same.
+func (l *RateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rule.Rate >= float64(l.rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+var (
+	rateLimitRules map[string]*RateLimitRule
+
+	// rateLimitersMu guards rateLimiters, which routes register into while the pruner walks it.
+	rateLimitersMu sync.Mutex
+	rateLimiters   = make(map[string]*RateLimiter)
+)
+
+func StartRateLimitPruner() {
+	go func() {
+		ticker := time.NewTicker(rateLimitPruneEvery)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			pruneRateLimiters(now)
+		}
+	}()
+}
+
+func pruneRateLimiters(now time.Time) {
+	rateLimitersMu.Lock()
+	limiters := make([]*RateLimiter, 0, len(rateLimiters))
+	for _, limiter := range rateLimiters {
+		limiters = append(limiters, limiter)
+	}
+	rateLimitersMu.Unlock()
+
+	for _, limiter := range limiters {
+		limiter.prune(now)
+	}
+}
+
+// routeLimiter returns the limiter for a rule, shared by every route registered under the same name.
+func routeLimiter(name string) *RateLimiter {
+	rule, exists := rateLimitRules[name]
+	if !exists || rule == nil {
+		return nil
+	}
+
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	if limiter, exists := rateLimiters[name]; exists {
+		return limiter
+	}
+
+	limiter := NewRateLimiter(*rule)
+	rateLimiters[name] = limiter
+	return limiter
+}
+
+// requestSessionID peeks at the sessionId in a JSON body, leaving the body intact for the handler.
+func requestSessionID(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(r.Body, maxSessionPeekSize))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var body struct {
+		SessionID string `json:"sessionId"`
+	}
+	if json.Unmarshal(peeked, &body) != nil {
+		return ""
+	}
+	return body.SessionID
+}
+
+func writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(RateLimitResponse{Message: "Too many requests, please slow down"})
+}
+
+// rateLimit wraps a handler in the route's IP and session limits. Routes without their own IP rule
+// share the api.ip budget. Rules must be loaded first.
+func rateLimit(route string, handler http.HandlerFunc) http.HandlerFunc {
+	ipLimiter := routeLimiter(route + ".ip")
+	if _, exists := rateLimitRules[route+".ip"]; !exists {
+		ipLimiter = routeLimiter(defaultRateLimitRoute + ".ip")
+	}
+	sessionLimiter := routeLimiter(route + ".session")
+
+	if ipLimiter == nil && sessionLimiter == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+
+		if ipLimiter != nil {
+			if allowed, wait := ipLimiter.Allow(clientIP(r), now); !allowed {
+				writeRateLimited(w, wait)
+				return
+			}
+		}
+
+		if sessionLimiter != nil {
+			if sessionID := requestSessionID(r); sessionID != "" {
+				if allowed, wait := sessionLimiter.Allow(sessionID, now); !allowed {
+					writeRateLimited(w, wait)
+					return
+				}
+			}
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitRule(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    *RateLimitRule
+		wantErr bool
+	}{
+		{"off", nil, false},
+		{"30/m", &RateLimitRule{Rate: 0.5, Burst: 30}, false},
+		{"30/m:10", &RateLimitRule{Rate: 0.5, Burst: 10}, false},
+		{"2/s", &RateLimitRule{Rate: 2, Burst: 2}, false},
+		{"36/h:1", &RateLimitRule{Rate: 0.01, Burst: 1}, false},
+		{"", nil, true},
+		{"30", nil, true},
+		{"30/d", nil, true},
+		{"0/m", nil, true},
+		{"-5/m", nil, true},
+		{"x/m", nil, true},
+		{"30/m:0", nil, true},
+		{"30/m:x", nil, true},
+		{"30/m:", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			rule, err := parseRateLimitRule(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRateLimitRule(%q) = %+v, want an error", tt.value, rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRateLimitRule(%q): %v", tt.value, err)
+			}
+			if (rule == nil) != (tt.want == nil) || (rule != nil && *rule != *tt.want) {
+				t.Errorf("parseRateLimitRule(%q) = %+v, want %+v", tt.value, rule, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		rule     RateLimitRule
+		requests []time.Duration // offsets from start
+		want     []bool
+		lastWait time.Duration
+	}{
+		{
+			name:     "burst then refused",
+			rule:     RateLimitRule{Rate: 1, Burst: 3},
+			requests: []time.Duration{0, 0, 0, 0},
+			want:     []bool{true, true, true, false},
+			lastWait: time.Second,
+		},
+		{
+			name:     "refills at the rate",
+			rule:     RateLimitRule{Rate: 1, Burst: 2},
+			requests: []time.Duration{0, 0, 0, 500 * time.Millisecond, time.Second},
+			want:     []bool{true, true, false, false, true},
+		},
+		{
+			name:     "refill is capped at the burst",
+			rule:     RateLimitRule{Rate: 1, Burst: 2},
+			requests: []time.Duration{0, time.Hour, time.Hour, time.Hour},
+			want:     []bool{true, true, true, false},
+			lastWait: time.Second,
+		},
+		{
+			name:     "wait reflects a partial token",
+			rule:     RateLimitRule{Rate: 0.5, Burst: 1},
+			requests: []time.Duration{0, 500 * time.Millisecond},
+			want:     []bool{true, false},
+			lastWait: 1500 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.rule)
+			var wait time.Duration
+			for i, offset := range tt.requests {
+				var allowed bool
+				allowed, wait = limiter.Allow("client", start.Add(offset))
+				if allowed != tt.want[i] {
+					t.Fatalf("request %d at +%v allowed = %v, want %v", i+1, offset, allowed, tt.want[i])
+				}
+				if allowed && wait != 0 {
+					t.Errorf("request %d allowed with a wait of %v", i+1, wait)
+				}
+			}
+			if tt.lastWait != 0 && wait != tt.lastWait {
+				t.Errorf("wait = %v, want %v", wait, tt.lastWait)
+			}
+		})
+	}
+}
+
+func TestRateLimiterKeysAreSeparate(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitRule{Rate: 1, Burst: 1})
+	now := time.Now()
+
+	if allowed, _ := limiter.Allow("a", now); !allowed {
+		t.Fatal("first request from a refused")
+	}
+	if allowed, _ := limiter.Allow("a", now); allowed {
+		t.Error("second request from a allowed")
+	}
+	if allowed, _ := limiter.Allow("b", now); !allowed {
+		t.Error("b refused because of a")
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimitRule{Rate: 1, Burst: 5})
+
+	limiter.Allow("drained", start)
+	limiter.Allow("drained", start)
+	limiter.Allow("drained", start)
+	limiter.Allow("recent", start.Add(3*time.Second))
+
+	tests := []struct {
+		at   time.Duration
+		want []string
+	}{
+		{time.Second, []string{"drained", "recent"}},
+		// drained is full again 3s after start; recent 1s after its request
+		{3 * time.Second, []string{"recent"}},
+		{4 * time.Second, nil},
+	}
+
+	for _, tt := range tests {
+		limiter.prune(start.Add(tt.at))
+		if len(limiter.buckets) != len(tt.want) {
+			t.Fatalf("after pruning at +%v: %d buckets, want %v", tt.at, len(limiter.buckets), tt.want)
+		}
+		for _, key := range tt.want {
+			if _, ok := limiter.buckets[key]; !ok {
+				t.Errorf("after pruning at +%v: %s was pruned", tt.at, key)
+			}
+		}
+	}
+
+	// A pruned key starts again from a full bucket.
+	for i := 0; i < 5; i++ {
+		if allowed, _ := limiter.Allow("drained", start.Add(4*time.Second)); !allowed {
+			t.Fatalf("request %d after pruning refused", i+1)
+		}
+	}
+}
+
+// Routes may register limiters while the pruner walks them; go test -race catches unguarded access.
+func TestRouteLimiterWhilePruning(t *testing.T) {
+	savedRules, savedLimiters := rateLimitRules, rateLimiters
+	t.Cleanup(func() { rateLimitRules, rateLimiters = savedRules, savedLimiters })
+
+	rateLimitRules = make(map[string]*RateLimitRule)
+	rateLimiters = make(map[string]*RateLimiter)
+	for i := 0; i < 50; i++ {
+		rateLimitRules[fmt.Sprintf("route%d.ip", i)] = &RateLimitRule{Rate: 1, Burst: 1}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			pruneRateLimiters(time.Now())
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		if routeLimiter(fmt.Sprintf("route%d.ip", i)) == nil {
+			t.Errorf("route%d.ip has no limiter", i)
+		}
+	}
+	wg.Wait()
+
+	if len(rateLimiters) != 50 {
+		t.Errorf("%d limiters registered, want 50", len(rateLimiters))
+	}
+	if routeLimiter("route0.ip") != rateLimiters["route0.ip"] {
+		t.Error("route0.ip limiter not shared")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type GridAttribute struct {
+	Key   string
+	Label string
+}
+
+// Columns shown in the guess grid, in the same order as game.html.
+var gridAttributes = []GridAttribute{
+	{Key: "name", Label: "Joueur"},
+	{Key: "team", Label: "Équipe"},
+	{Key: "year_of_birth", Label: "Année Naissance"},
+	{Key: "role", Label: "Rôle"},
+	{Key: "country", Label: "Pays"},
+	{Key: "last_split_result", Label: "Résultat dernier split"},
+	{Key: "first_split_in_league", Label: "Arrivé dans la ligue en"},
+}
+
+type RunCell struct {
+	Value string
+	Image string
+	Class string
+	Arrow string
+}
+
+type RunTargetView struct {
+	Number            int
+	PlayerID          string
+	Team              string
+	Outcome           TargetOutcome
+	OutcomeLabel      string
+	FormattedDuration string
+	Rows              [][]RunCell
+}
+
+type RunPageData struct {
+	Run               *Run
+	DifficultyInfo    map[string]map[string]interface{}
+	TotalPlayers      int
+	FormattedDate     string
+	FormattedDuration string
+	GridAttributes    []GridAttribute
+	Targets           []RunTargetView
+	ShareFormat       ShareFormat
+	ShareText         string
+}
+
+func guessComparison(guess GuessResult, key string) ComparisonResult {
+	if key == "name" {
+		if guess.IsCorrect {
+			return ComparisonExact
+		}
+		return ComparisonWrong
+	}
+
+	if comparison, exists := guess.Comparisons[key]; exists {
+		return comparison
+	}
+	return ComparisonWrong
+}
+
+func buildRunCell(guess GuessResult, key string) RunCell {
+	player := guess.GuessedPlayer
+	comparison := guessComparison(guess, key)
+
+	cell := RunCell{}
+	switch comparison {
+	case ComparisonExact:
+		cell.Class = "correct"
+	case ComparisonPartial:
+		cell.Class = "partial"
+	default:
+		cell.Class = "wrong"
+	}
+
+	switch key {
+	case "name":
+		cell.Value = player.ID
+	case "team":
+		cell.Value = player.Team
+		cell.Image = "/assets/teams/" + player.Team + ".png"
+	case "year_of_birth":
+		cell.Value = strconv.Itoa(player.YearOfBirth)
+	case "role":
+		cell.Value = player.Role
+	case "country":
+		cell.Value = player.Nationality
+	case "last_split_result":
+		cell.Value = player.LastSplitResult
+	case "first_split_in_league":
+		cell.Value = strconv.Itoa(player.FirstSplitInLeague)
+	}
+
+	if comparison == ComparisonHigher {
+		cell.Arrow = "↑"
+	} else if comparison == ComparisonLower {
+		cell.Arrow = "↓"
+	}
+
+	return cell
+}
+
+func outcomeLabel(outcome TargetOutcome) string {
+	switch outcome {
+	case TargetFound:
+		return "Trouvé"
+	case TargetMissed:
+		return "Manqué"
+	case TargetUnplayed:
+		return "Non joué"
+	default:
+		return "En cours"
+	}
+}
+
+func BuildRunTargetViews(run *Run) []RunTargetView {
+	views := make([]RunTargetView, 0, len(run.Targets))
+
+	for i, target := range run.Targets {
+		if target.Outcome == TargetUnplayed {
+			continue
+		}
+
+		view := RunTargetView{
+			Number:       i + 1,
+			PlayerID:     target.PlayerID,
+			Outcome:      target.Outcome,
+			OutcomeLabel: outcomeLabel(target.Outcome),
+		}
+
+		if player, exists := GetPlayerByName(target.PlayerID); exists {
+			view.Team = player.Team
+		}
+
+		if target.EndTime != nil {
+			view.FormattedDuration = FormatDuration(int(target.EndTime.Sub(target.StartTime).Seconds()))
+		}
+
+		for _, guess := range target.Guesses {
+			row := make([]RunCell, len(gridAttributes))
+			for j, attribute := range gridAttributes {
+				row[j] = buildRunCell(guess, attribute.Key)
+			}
+			view.Rows = append(view.Rows, row)
+		}
+
+		views = append(views, view)
+	}
+
+	return views
+}
+
+func runHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	run, err := store.GetRun(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Error loading run", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading run", "run", r.PathValue("id"), "error", err)
+		return
+	}
+
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	shareFormat := ParseShareFormat(r.URL.Query().Get("format"))
+
+	data := RunPageData{
+		Run:               run,
+		DifficultyInfo:    GetDifficultyInfo(),
+		TotalPlayers:      len(run.Lineup),
+		FormattedDate:     run.EndTime.Format("Jan 2, 2006"),
+		FormattedDuration: FormatDuration(int(run.EndTime.Sub(run.StartTime).Seconds())),
+		GridAttributes:    gridAttributes,
+		Targets:           BuildRunTargetViews(run),
+		ShareFormat:       shareFormat,
+		ShareText:         BuildShareText(run, shareFormat),
+	}
+
+	err = templates.ExecuteTemplate(w, "run.html", data)
+	if err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template error", "template", "run.html", "error", err)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const certCheckInterval = time.Minute
+
+type ServerConfig struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration
+	TLSCertFile       string
+	TLSKeyFile        string
+}
+
+func (c ServerConfig) TLS() bool {
+	return c.TLSCertFile != ""
+}
+
+func envDuration(name string, value *time.Duration) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil || duration < 0 {
+		return fmt.Errorf("invalid %s %q", name, raw)
+	}
+	*value = duration
+	return nil
+}
+
+// LoadServerConfig reads PORT, the HTTP_*_TIMEOUT durations, HTTP_MAX_HEADER_BYTES, SHUTDOWN_TIMEOUT,
+// and TLS_CERT_FILE with TLS_KEY_FILE to serve HTTPS. A zero timeout means none.
+// The write timeout bounds whole responses, so it must outlast the slowest admin export.
+func LoadServerConfig() (ServerConfig, error) {
+	config := ServerConfig{
+		Addr:              ":8080",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		ShutdownTimeout:   30 * time.Second,
+		TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+	}
+
+	if port := os.Getenv("PORT"); port != "" {
+		config.Addr = ":" + port
+	}
+
+	durations := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", &config.ReadTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", &config.ReadHeaderTimeout},
+		{"HTTP_WRITE_TIMEOUT", &config.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", &config.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", &config.ShutdownTimeout},
+	}
+	for _, d := range durations {
+		if err := envDuration(d.name, d.value); err != nil {
+			return config, err
+		}
+	}
+
+	if value := os.Getenv("HTTP_MAX_HEADER_BYTES"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			return config, fmt.Errorf("invalid HTTP_MAX_HEADER_BYTES %q", value)
+		}
+		config.MaxHeaderBytes = size
+	}
+
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return config, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	return config, nil
+}
+
+// certReloader serves the certificate from disk, reloading it on SIGHUP or when the files change,
+// so renewed certificates are picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (c *certReloader) lastModified() time.Time {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+func (c *certReloader) reload() error {
+	modified := c.lastModified()
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.modified = modified
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// watch keeps the previous certificate when a reload fails, e.g. while the files are half written.
+func (c *certReloader) watch(ctx context.Context) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+		case <-ticker.C:
+			c.mu.RLock()
+			unchanged := !c.lastModified().After(c.modified)
+			c.mu.RUnlock()
+			if unchanged {
+				continue
+			}
+		}
+
+		if err := c.reload(); err != nil {
+			slog.Error("Error reloading TLS certificate", "error", err)
+			continue
+		}
+		slog.Info("Reloaded TLS certificate", "cert", c.certFile)
+	}
+}
+
+// Serve runs the server until SIGINT or SIGTERM, then stops accepting connections, lets in-flight
+// requests finish, saves the sessions in memory and closes the database.
+func Serve(config ServerConfig, handler http.Handler) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	if config.TLS() {
+		reloader, err := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		go reloader.watch(ctx)
+
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "addr", config.Addr, "tls", config.TLS())
+		if config.TLS() {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("Shutting down, draining requests", "timeout", config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %v", err))
+	}
+
+	if err := FlushSessions(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save sessions: %v", err))
+	}
+
+	if err := store.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close database: %v", err))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	slog.Info("Server stopped")
+	return nil
+}
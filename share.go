@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ShareFormat string
+
+const (
+	ShareFormatFull    ShareFormat = "full"
+	ShareFormatCompact ShareFormat = "compact"
+)
+
+const (
+	// Discord message limit for the full grid, tweet length for the compact one.
+	ShareFullMaxLength    = 2000
+	ShareCompactMaxLength = 280
+)
+
+const (
+	shareSquareExact   = "🟩"
+	shareSquarePartial = "🟨"
+	shareSquareWrong   = "⬛"
+	shareMissedMarker  = "❌"
+)
+
+func ParseShareFormat(format string) ShareFormat {
+	if ShareFormat(format) == ShareFormatFull {
+		return ShareFormatFull
+	}
+	return ShareFormatCompact
+}
+
+func difficultyTitle(difficulty string) string {
+	if difficulty == "" {
+		return difficulty
+	}
+	return strings.ToUpper(difficulty[:1]) + difficulty[1:]
+}
+
+func comparisonSquare(comparison ComparisonResult) string {
+	switch comparison {
+	case ComparisonExact:
+		return shareSquareExact
+	case ComparisonPartial:
+		return shareSquarePartial
+	default:
+		return shareSquareWrong
+	}
+}
+
+func guessSquares(guess GuessResult, format ShareFormat) string {
+	if format == ShareFormatFull {
+		var squares strings.Builder
+		for _, attribute := range gridAttributes {
+			squares.WriteString(comparisonSquare(guessComparison(guess, attribute.Key)))
+		}
+		return squares.String()
+	}
+
+	if guess.IsCorrect {
+		return shareSquareExact
+	}
+	for _, attribute := range gridAttributes {
+		comparison := guessComparison(guess, attribute.Key)
+		if comparison == ComparisonExact || comparison == ComparisonPartial {
+			return shareSquarePartial
+		}
+	}
+	return shareSquareWrong
+}
+
+// shareLength approximates how Twitter and Discord count characters: emoji count double.
+func shareLength(text string) int {
+	length := 0
+	for _, char := range text {
+		if char >= 0x2000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+	return length
+}
+
+func buildShareLine(target TargetAttempt, format ShareFormat, maxGuesses int) string {
+	guesses := target.Guesses
+	hidden := 0
+	if maxGuesses > 0 && len(guesses) > maxGuesses {
+		hidden = len(guesses) - maxGuesses
+		guesses = guesses[hidden:]
+	}
+
+	parts := make([]string, 0, len(guesses)+2)
+	if hidden > 0 {
+		parts = append(parts, fmt.Sprintf("+%d", hidden))
+	}
+	for _, guess := range guesses {
+		parts = append(parts, guessSquares(guess, format))
+	}
+	if target.Outcome != TargetFound {
+		parts = append(parts, shareMissedMarker)
+	}
+
+	separator := ""
+	if format == ShareFormatFull {
+		separator = " "
+	}
+	return strings.Join(parts, separator)
+}
+
+func BuildShareText(run *Run, format ShareFormat) string {
+	header := fmt.Sprintf("Prodle %s - %d pts - %d/%d", difficultyTitle(run.Difficulty), run.Score, run.PlayersFound, len(run.Lineup))
+
+	maxLength := ShareCompactMaxLength
+	if format == ShareFormatFull {
+		maxLength = ShareFullMaxLength
+	}
+
+	longestTarget := 0
+	for _, target := range run.Targets {
+		if len(target.Guesses) > longestTarget {
+			longestTarget = len(target.Guesses)
+		}
+	}
+
+	// Show as many trailing guesses per target as fit, down to the last one.
+	var text string
+	for maxGuesses := longestTarget; ; maxGuesses-- {
+		lines := []string{header}
+		for _, target := range run.Targets {
+			if target.Outcome == TargetUnplayed {
+				continue
+			}
+			lines = append(lines, buildShareLine(target, format, maxGuesses))
+		}
+
+		text = strings.Join(lines, "\n")
+		if maxGuesses <= 1 || shareLength(text) <= maxLength {
+			break
+		}
+	}
+
+	return text
+}
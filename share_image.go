@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	shareImageWidth    = 1200
+	shareImageHeight   = 630
+	shareImageCacheDir = "cache/share"
+	shareLogoSize      = 72
+	shareLogoGap       = 12
+
+	// Cards are cached per rank, so a run that moves on the leaderboard leaves stale files behind
+	shareImageCacheTTL   = 7 * 24 * time.Hour
+	maxCachedShareImages = 2000
+)
+
+var (
+	shareColorBackground = color.RGBA{0x1A, 0x20, 0x2C, 0xFF}
+	shareColorPanel      = color.RGBA{0x2D, 0x37, 0x48, 0xFF}
+	shareColorGold       = color.RGBA{0xD6, 0x9E, 0x2E, 0xFF}
+	shareColorGreen      = color.RGBA{0x68, 0xD3, 0x91, 0xFF}
+	shareColorText       = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+var (
+	shareFontsOnce sync.Once
+	shareBoldFont  *opentype.Font
+	shareTextFont  *opentype.Font
+	shareFontsErr  error
+)
+
+func loadShareFonts() error {
+	shareFontsOnce.Do(func() {
+		shareBoldFont, shareFontsErr = opentype.Parse(gobold.TTF)
+		if shareFontsErr != nil {
+			return
+		}
+		shareTextFont, shareFontsErr = opentype.Parse(goregular.TTF)
+	})
+	return shareFontsErr
+}
+
+func shareFace(f *opentype.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+func drawCenteredText(dst *image.RGBA, face font.Face, text string, y int, c color.Color) {
+	drawer := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+	}
+	width := drawer.MeasureString(text).Round()
+	drawer.Dot = fixed.P((shareImageWidth-width)/2, y)
+	drawer.DrawString(text)
+}
+
+func loadTeamLogo(team string) image.Image {
+	file, err := os.Open(filepath.Join("assets", "teams", team+".png"))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	logo, err := png.Decode(file)
+	if err != nil {
+		slog.Error("Error decoding team logo", "team", team, "error", err)
+		return nil
+	}
+	return logo
+}
+
+func drawTeamLogos(dst *image.RGBA, teams []string, top int) {
+	logos := make([]image.Image, 0, len(teams))
+	for _, team := range teams {
+		if logo := loadTeamLogo(team); logo != nil {
+			logos = append(logos, logo)
+		}
+	}
+
+	perRow := (shareImageWidth - 80 + shareLogoGap) / (shareLogoSize + shareLogoGap)
+	for row := 0; row*perRow < len(logos); row++ {
+		rowLogos := logos[row*perRow:]
+		if len(rowLogos) > perRow {
+			rowLogos = rowLogos[:perRow]
+		}
+
+		rowWidth := len(rowLogos)*(shareLogoSize+shareLogoGap) - shareLogoGap
+		x := (shareImageWidth - rowWidth) / 2
+		y := top + row*(shareLogoSize+shareLogoGap)
+
+		for _, logo := range rowLogos {
+			bounds := logo.Bounds()
+			scale := float64(shareLogoSize) / float64(max(bounds.Dx(), bounds.Dy()))
+			w := int(float64(bounds.Dx()) * scale)
+			h := int(float64(bounds.Dy()) * scale)
+			offsetX := x + (shareLogoSize-w)/2
+			offsetY := y + (shareLogoSize-h)/2
+
+			xdraw.CatmullRom.Scale(dst, image.Rect(offsetX, offsetY, offsetX+w, offsetY+h), logo, bounds, xdraw.Over, nil)
+			x += shareLogoSize + shareLogoGap
+		}
+	}
+}
+
+func RenderShareImage(run *Run, rank int) ([]byte, error) {
+	if err := loadShareFonts(); err != nil {
+		return nil, fmt.Errorf("failed to load fonts: %v", err)
+	}
+
+	titleFace, err := shareFace(shareBoldFont, 72)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create title font: %v", err)
+	}
+	defer titleFace.Close()
+
+	scoreFace, err := shareFace(shareBoldFont, 96)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create score font: %v", err)
+	}
+	defer scoreFace.Close()
+
+	textFace, err := shareFace(shareTextFont, 36)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create text font: %v", err)
+	}
+	defer textFace.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, shareImageWidth, shareImageHeight))
+	xdraw.Draw(img, img.Bounds(), image.NewUniform(shareColorBackground), image.Point{}, xdraw.Src)
+	xdraw.Draw(img, image.Rect(40, 40, shareImageWidth-40, shareImageHeight-40), image.NewUniform(shareColorPanel), image.Point{}, xdraw.Src)
+
+	difficultyName := strings.ToUpper(run.Difficulty)
+	drawCenteredText(img, titleFace, "PRODLE "+difficultyName, 130, shareColorGold)
+	drawCenteredText(img, scoreFace, fmt.Sprintf("%d pts", run.Score), 250, shareColorGreen)
+
+	details := fmt.Sprintf("Joueurs trouvés: %d/%d", run.PlayersFound, len(run.Lineup))
+	if rank > 0 {
+		details = fmt.Sprintf("Rang #%d  -  %s", rank, details)
+	}
+	drawCenteredText(img, textFace, details, 320, shareColorText)
+
+	var teams []string
+	for _, target := range run.Targets {
+		if target.Outcome != TargetFound {
+			continue
+		}
+		if player, exists := GetPlayerByName(target.PlayerID); exists {
+			teams = append(teams, player.Team)
+		}
+	}
+	drawTeamLogos(img, teams, 370)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode share image: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func shareImagePath(runID string, rank int) string {
+	return filepath.Join(shareImageCacheDir, fmt.Sprintf("%s-%d.png", runID, rank))
+}
+
+// GetShareImage returns the cached card for a run, rendering it on first request. The card only shows
+// a rank when the run has a visible entry on the all-time leaderboard.
+func GetShareImage(run *Run) ([]byte, error) {
+	_, rank, err := store.GetLeaderboardAroundRun(run.Difficulty, WindowAllTime, ViewAll, run.ID, 0)
+	if err != nil {
+		slog.Error("Error calculating rank", "run", run.ID, "error", err)
+		rank = 0
+	}
+
+	path := shareImagePath(run.ID, rank)
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	data, err := RenderShareImage(run, rank)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(shareImageCacheDir, 0755); err != nil {
+		slog.Error("Error creating share image cache", "error", err)
+		return data, nil
+	}
+
+	if err := writeShareImage(path, data); err != nil {
+		slog.Error("Error caching share image", "run", run.ID, "error", err)
+		return data, nil
+	}
+
+	if err := pruneShareImages(time.Now()); err != nil {
+		slog.Error("Error pruning share image cache", "error", err)
+	}
+
+	return data, nil
+}
+
+// writeShareImage writes through a temporary file of its own, so concurrent renders of the same card
+// never rename a half-written one into place.
+func writeShareImage(path string, data []byte) error {
+	tmp, err := os.CreateTemp(shareImageCacheDir, "render-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// pruneShareImages drops cached cards older than the TTL, then the oldest ones above the size bound.
+func pruneShareImages(now time.Time) error {
+	entries, err := os.ReadDir(shareImageCacheDir)
+	if err != nil {
+		return err
+	}
+
+	type cachedImage struct {
+		path     string
+		modified time.Time
+	}
+
+	var kept []cachedImage
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".png" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(shareImageCacheDir, entry.Name())
+		if now.Sub(info.ModTime()) > shareImageCacheTTL {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, cachedImage{path: path, modified: info.ModTime()})
+	}
+
+	if len(kept) <= maxCachedShareImages {
+		return nil
+	}
+
+	sort.Slice(kept, func(i, j int) bool { return kept[i].modified.After(kept[j].modified) })
+	for _, cached := range kept[maxCachedShareImages:] {
+		if err := os.Remove(cached.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shareImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	run, err := store.GetRun(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Error loading run", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading run", "run", r.PathValue("id"), "error", err)
+		return
+	}
+
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := GetShareImage(run)
+	if err != nil {
+		http.Error(w, "Error rendering image", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error rendering share image", "run", run.ID, "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(data)
+}
+
+// publicBaseURL is where the site is reached from outside, used for the absolute links in share pages.
+var publicBaseURL string
+
+// LoadPublicBaseURL reads PUBLIC_BASE_URL, e.g. https://prodle.example.com. The request's Host header
+// is never used instead, since a forged one would end up in pages crawlers cache. Without it share
+// pages link with root-relative URLs, which most link previews do not follow.
+func LoadPublicBaseURL() (string, error) {
+	value := os.Getenv("PUBLIC_BASE_URL")
+	if value == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid PUBLIC_BASE_URL %q", value)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+func sharePageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	run, err := store.GetRun(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Error loading run", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading run", "run", r.PathValue("id"), "error", err)
+		return
+	}
+
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		Run         *Run
+		Title       string
+		Description string
+		ImageURL    string
+		RunURL      string
+	}{
+		Run:         run,
+		Title:       fmt.Sprintf("Prodle %s - %d pts", difficultyTitle(run.Difficulty), run.Score),
+		Description: fmt.Sprintf("%d/%d joueurs trouvés", run.PlayersFound, len(run.Lineup)),
+		ImageURL:    publicBaseURL + "/share/" + run.ID + "/image.png",
+		RunURL:      publicBaseURL + "/run/" + run.ID,
+	}
+
+	err = templates.ExecuteTemplate(w, "share.html", data)
+	if err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template error", "template", "share.html", "error", err)
+	}
+}
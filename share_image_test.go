@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadPublicBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"unset", "", "", false},
+		{"https", "https://prodle.example.com", "https://prodle.example.com", false},
+		{"trailing slash", "https://prodle.example.com/", "https://prodle.example.com", false},
+		{"sub path", "http://example.com/prodle/", "http://example.com/prodle", false},
+		{"no scheme", "prodle.example.com", "", true},
+		{"other scheme", "ftp://prodle.example.com", "", true},
+		{"query", "https://prodle.example.com/?ref=1", "", true},
+		{"fragment", "https://prodle.example.com/#top", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PUBLIC_BASE_URL", tt.value)
+
+			got, err := LoadPublicBaseURL()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadPublicBaseURL = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPublicBaseURL: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("LoadPublicBaseURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteShareImageConcurrently(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(shareImageCacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := shareImagePath("run", 1)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := writeShareImage(path, bytes.Repeat([]byte{byte('a' + i)}, 1<<16)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1<<16 || !bytes.Equal(data, bytes.Repeat(data[:1], len(data))) {
+		t.Errorf("cached card of %d bytes is not one complete render", len(data))
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(shareImageCacheDir, "*.tmp"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %s", strings.Join(leftovers, ", "))
+	}
+}
@@ -1,8 +1,20 @@
+// French messages for the error codes returned by /api/submit-score
+const SUBMIT_ERROR_MESSAGES = {
+    username_length: 'Le nom doit contenir entre 1 et 50 caractères',
+    username_invalid_characters: 'Le nom contient des caractères invisibles ou non autorisés',
+    username_confusable: 'Le nom mélange des caractères d\'alphabets différents',
+    username_blocked: 'Ce nom n\'est pas autorisé',
+    username_impersonation: 'Ce nom appartient à un joueur professionnel',
+    username_reserved: 'Ce nom appartient à un compte enregistré',
+    banned: 'Vous êtes banni du classement',
+    already_submitted: 'Cette partie a déjà été enregistrée'
+};
+
 class GameManager {
     constructor() {
         this.sessionId = '';
         this.currentPlayer = 1;
-        this.totalPlayers = 20;
+        this.totalPlayers = parseInt(document.getElementById('player-counter')?.dataset.total, 10) || 20;
         this.score = 0;
         this.guessCount = 0;
         this.isGameActive = false;
@@ -28,6 +40,7 @@ class GameManager {
         this.scoreSubmitted = document.getElementById('score-submitted');
         this.submitScoreBtn = document.getElementById('submit-score-btn');
         this.playerRankElement = document.getElementById('player-rank');
+        this.rankNeighbourhoodElement = document.getElementById('rank-neighbourhood');
         this.missedPlayerInfo = document.getElementById('missed-player-info');
         this.missedPlayerName = document.getElementById('missed-player-name');
         
@@ -913,6 +926,8 @@ class GameManager {
             if (data.success) {
                 // Store missed player data if provided
                 this.missedPlayer = data.missed_player || null;
+                this.runId = data.runId || null;
+                this.shareText = data.shareText || null;
             } else {
                 console.error('Failed to mark game as completed:', data.message);
             }
@@ -945,10 +960,24 @@ class GameManager {
         }
         
         
+        // Link to the replay of the finished run
+        const runLink = document.getElementById('run-link');
+        if (this.runId && runLink) {
+            runLink.href = `/run/${this.runId}`;
+            runLink.classList.remove('hidden');
+        }
+
+        const shareBtn = document.getElementById('share-btn');
+        if (this.shareText && shareBtn) {
+            shareBtn.classList.remove('hidden');
+        }
+        
         this.scoreForm.classList.remove('hidden');
         this.scoreSubmitted.classList.add('hidden');
         
         
+        this.prefillAccountUsername();
+        
         setTimeout(() => {
             if (this.usernameInput) {
                 this.usernameInput.focus();
@@ -958,6 +987,22 @@ class GameManager {
         this.endGameOverlay.classList.remove('hidden');
     }
 
+    /**
+     * Registered players submit under their account name
+     */
+    async prefillAccountUsername() {
+        try {
+            const response = await fetch('/api/me');
+            const data = await response.json();
+            if (data.loggedIn && data.account && this.usernameInput) {
+                this.usernameInput.value = data.account.username;
+                this.usernameInput.readOnly = true;
+            }
+        } catch (error) {
+            console.error('Error fetching account:', error);
+        }
+    }
+
     /**
      * Task 28: Implement score submission
      */
@@ -993,12 +1038,19 @@ class GameManager {
 
             const data = await response.json();
             
-            if (data.success) {
+            if (data.success && data.pendingReview) {
+                this.showScoreSubmitted();
+                if (this.playerRankElement) {
+                    this.playerRankElement.textContent = 'Votre score apparaîtra au classement après vérification';
+                    this.playerRankElement.classList.remove('hidden');
+                }
+            } else if (data.success) {
                 
                 this.showScoreSubmitted(data.rank);
+                this.loadRankNeighbourhood();
                 this.loadLeaderboard(); 
             } else {
-                alert('Erreur lors de l\'enregistrement: ' + (data.message || 'Erreur inconnue'));
+                alert('Erreur lors de l\'enregistrement: ' + (SUBMIT_ERROR_MESSAGES[data.code] || data.message || 'Erreur inconnue'));
                 this.submitScoreBtn.disabled = false;
                 this.submitScoreBtn.textContent = 'Enregistrer Score';
             }
@@ -1035,6 +1087,25 @@ class GameManager {
         }
     }
 
+    /**
+     * Copy the emoji result grid to the clipboard
+     */
+    async copyShareText() {
+        if (!this.shareText) {
+            return;
+        }
+
+        try {
+            await navigator.clipboard.writeText(this.shareText);
+            const shareBtn = document.getElementById('share-btn');
+            if (shareBtn) {
+                shareBtn.textContent = 'Copié!';
+            }
+        } catch (error) {
+            console.error('Error copying share text:', error);
+        }
+    }
+
     /**
      * Task 29: Build restart functionality - Simply redirect to home page
      */
@@ -1067,6 +1138,47 @@ class GameManager {
     }
 
 
+    /**
+     * Show the leaderboard entries just above and below the submitted score
+     */
+    async loadRankNeighbourhood() {
+        if (!this.rankNeighbourhoodElement) {
+            return;
+        }
+
+        try {
+            const response = await fetch(`/api/leaderboard?view=all&radius=2&around=${encodeURIComponent(this.sessionId)}`);
+            const data = await response.json();
+
+            if (!data.success || !data.entries.length) {
+                return;
+            }
+
+            this.rankNeighbourhoodElement.innerHTML = '';
+            data.entries.forEach(entry => {
+                const row = document.createElement('div');
+                row.className = 'rank-neighbourhood-entry';
+                if (entry.rank === data.position) {
+                    row.classList.add('current');
+                }
+
+                const rank = document.createElement('span');
+                rank.textContent = `#${entry.rank}`;
+                const name = document.createElement('span');
+                name.textContent = entry.username;
+                const score = document.createElement('span');
+                score.textContent = `${entry.score} pts`;
+
+                row.append(rank, name, score);
+                this.rankNeighbourhoodElement.appendChild(row);
+            });
+
+            this.rankNeighbourhoodElement.classList.remove('hidden');
+        } catch (error) {
+            console.error('Error loading rank neighbourhood:', error);
+        }
+    }
+
     /**
      * Load leaderboard for sidebar
      */
@@ -1097,6 +1209,12 @@ function restartGame() {
     }
 }
 
+function copyShareText() {
+    if (window.gameManager) {
+        window.gameManager.copyShareText();
+    }
+}
+
 
 document.addEventListener('DOMContentLoaded', function() {
     console.log('Complete game flow system initialized');
@@ -2,7 +2,7 @@
 class TimerManager {
     constructor() {
         this.timerElement = document.getElementById('timer');
-        this.totalGameTime = 120; 
+        this.totalGameTime = parseInt(this.timerElement?.dataset.total, 10) || 120;
         this.timeLeft = this.totalGameTime;
         this.intervalId = null;
         this.isRunning = false;
@@ -21,7 +21,8 @@ class TimerManager {
      */
     async loadGameConfig() {
         try {
-            const response = await fetch('/api/config');
+            const difficulty = new URLSearchParams(window.location.search).get('difficulty') || 'difficile';
+            const response = await fetch(`/api/config?difficulty=${encodeURIComponent(difficulty)}`);
             const data = await response.json();
             
             if (data.success && data.config) {
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxCommonWrongGuesses = 5
+
+	// The aggregate reads every target result, so it is rebuilt at most this often
+	allPlayerStatsTTL = 5 * time.Minute
+)
+
+var allPlayerStatsCache struct {
+	sync.Mutex
+	players         []PlayerTargetStats
+	greenAttributes map[string]int
+	expires         time.Time
+}
+
+type GuessCount struct {
+	PlayerID string `json:"player_id"`
+	Count    int    `json:"count"`
+}
+
+type PlayerTargetStats struct {
+	PlayerID           string         `json:"player_id"`
+	Team               string         `json:"team"`
+	League             string         `json:"league"`
+	TimesDrawn         int            `json:"times_drawn"`
+	TimesFound         int            `json:"times_found"`
+	SolveRate          float64        `json:"solve_rate"`
+	MedianTimeSeconds  float64        `json:"median_time_seconds"`
+	MedianGuesses      float64        `json:"median_guesses"`
+	CommonWrongGuesses []GuessCount   `json:"common_wrong_guesses"`
+	GreenAttributes    map[string]int `json:"green_attributes"`
+}
+
+type PlayerStatsResponse struct {
+	Success bool               `json:"success"`
+	Message string             `json:"message,omitempty"`
+	Stats   *PlayerTargetStats `json:"stats,omitempty"`
+}
+
+type AllPlayerStatsResponse struct {
+	Success         bool                `json:"success"`
+	Message         string              `json:"message,omitempty"`
+	Players         []PlayerTargetStats `json:"players"`
+	GreenAttributes map[string]int      `json:"green_attributes"`
+}
+
+func BuildPlayerTargetStats(playerID string, results []TargetResult) PlayerTargetStats {
+	stats := PlayerTargetStats{
+		PlayerID:           playerID,
+		CommonWrongGuesses: []GuessCount{},
+		GreenAttributes:    make(map[string]int),
+	}
+
+	if player, exists := GetPlayerByName(playerID); exists {
+		stats.Team = player.Team
+		stats.League = player.League
+	}
+
+	var solveTimes []float64
+	var solveGuesses []float64
+	wrongGuesses := make(map[string]int)
+
+	for _, result := range results {
+		stats.TimesDrawn++
+
+		for _, guess := range result.Guesses {
+			if guess.PlayerID != result.PlayerID {
+				wrongGuesses[guess.PlayerID]++
+			}
+			for _, attribute := range guess.Exact {
+				stats.GreenAttributes[attribute]++
+			}
+		}
+
+		if result.Found {
+			stats.TimesFound++
+			solveTimes = append(solveTimes, result.EndTime.Sub(result.StartTime).Seconds())
+			solveGuesses = append(solveGuesses, float64(len(result.Guesses)))
+		}
+	}
+
+	if stats.TimesDrawn > 0 {
+		stats.SolveRate = float64(stats.TimesFound) / float64(stats.TimesDrawn)
+	}
+	stats.MedianTimeSeconds = median(solveTimes)
+	stats.MedianGuesses = median(solveGuesses)
+
+	for guessedID, count := range wrongGuesses {
+		stats.CommonWrongGuesses = append(stats.CommonWrongGuesses, GuessCount{PlayerID: guessedID, Count: count})
+	}
+	sort.Slice(stats.CommonWrongGuesses, func(i, j int) bool {
+		if stats.CommonWrongGuesses[i].Count != stats.CommonWrongGuesses[j].Count {
+			return stats.CommonWrongGuesses[i].Count > stats.CommonWrongGuesses[j].Count
+		}
+		return stats.CommonWrongGuesses[i].PlayerID < stats.CommonWrongGuesses[j].PlayerID
+	})
+	if len(stats.CommonWrongGuesses) > maxCommonWrongGuesses {
+		stats.CommonWrongGuesses = stats.CommonWrongGuesses[:maxCommonWrongGuesses]
+	}
+
+	return stats
+}
+
+func BuildAllPlayerTargetStats(results []TargetResult) []PlayerTargetStats {
+	grouped := make(map[string][]TargetResult)
+	for _, result := range results {
+		grouped[result.PlayerID] = append(grouped[result.PlayerID], result)
+	}
+
+	allStats := make([]PlayerTargetStats, 0, len(grouped))
+	for playerID, playerResults := range grouped {
+		allStats = append(allStats, BuildPlayerTargetStats(playerID, playerResults))
+	}
+
+	sort.Slice(allStats, func(i, j int) bool {
+		if allStats[i].SolveRate != allStats[j].SolveRate {
+			return allStats[i].SolveRate < allStats[j].SolveRate
+		}
+		if allStats[i].TimesDrawn != allStats[j].TimesDrawn {
+			return allStats[i].TimesDrawn > allStats[j].TimesDrawn
+		}
+		return allStats[i].PlayerID < allStats[j].PlayerID
+	})
+
+	return allStats
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+func playerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	player, exists := GetPlayerByName(r.PathValue("id"))
+	if !exists {
+		response := PlayerStatsResponse{
+			Success: false,
+			Message: "Player not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	results, err := store.GetTargetResults(player.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting target results", "player", player.ID, "error", err)
+		response := PlayerStatsResponse{
+			Success: false,
+			Message: "Failed to load player statistics",
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	stats := BuildPlayerTargetStats(player.ID, results)
+
+	response := PlayerStatsResponse{
+		Success: true,
+		Stats:   &stats,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func allPlayerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	players, greenAttributes, err := loadAllPlayerStats()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting target results", "error", err)
+		response := AllPlayerStatsResponse{
+			Success: false,
+			Message: "Failed to load player statistics",
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := AllPlayerStatsResponse{
+		Success:         true,
+		Players:         players,
+		GreenAttributes: greenAttributes,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadAllPlayerStats serves the aggregate from a cache. Concurrent requests wait for a single rebuild
+// rather than each loading the whole table.
+func loadAllPlayerStats() ([]PlayerTargetStats, map[string]int, error) {
+	allPlayerStatsCache.Lock()
+	defer allPlayerStatsCache.Unlock()
+
+	if time.Now().Before(allPlayerStatsCache.expires) {
+		return allPlayerStatsCache.players, allPlayerStatsCache.greenAttributes, nil
+	}
+
+	results, err := store.GetTargetResults("")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	players := BuildAllPlayerTargetStats(results)
+
+	greenAttributes := make(map[string]int)
+	for _, stats := range players {
+		for attribute, count := range stats.GreenAttributes {
+			greenAttributes[attribute] += count
+		}
+	}
+
+	allPlayerStatsCache.players = players
+	allPlayerStatsCache.greenAttributes = greenAttributes
+	allPlayerStatsCache.expires = time.Now().Add(allPlayerStatsTTL)
+	return players, greenAttributes, nil
+}
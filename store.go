@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrRunAlreadySubmitted is returned when a run already has a leaderboard entry.
+var ErrRunAlreadySubmitted = errors.New("run already submitted to the leaderboard")
+
+// ErrUsernameTaken is returned when an account name, once folded, matches an existing account's.
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// Store is everything the game persists: leaderboards, runs, per-target stats, accounts and moderation.
+type Store interface {
+	AddLeaderboardEntryByDifficulty(entry LeaderboardEntry, difficulty string) error
+	GetLeaderboardPageByDifficulty(difficulty string, window LeaderboardWindow, view LeaderboardView, offset, limit int) ([]LeaderboardEntry, error)
+	CountLeaderboardByDifficulty(difficulty string, window LeaderboardWindow, view LeaderboardView) (int, error)
+	GetLeaderboardAroundRun(difficulty string, window LeaderboardWindow, view LeaderboardView, runID string, radius int) ([]LeaderboardEntry, int, error)
+	GetPlayerRankByDifficulty(score int, duration int, difficulty string, window LeaderboardWindow) (int, error)
+	ExportLeaderboardEntries(filter LeaderboardFilter) ([]LeaderboardEntry, error)
+	ImportLeaderboardEntries(entries []LeaderboardEntry, action ModerationAction) (int, error)
+
+	GetRecentLeaderboardEntries(offset, limit int) ([]LeaderboardEntry, error)
+	GetLeaderboardEntry(id int64) (*LeaderboardEntry, error)
+	SetLeaderboardEntryHidden(id int64, hidden bool, action ModerationAction) (bool, error)
+	DeleteLeaderboardEntry(id int64, action ModerationAction) (bool, error)
+	AddBan(ban Ban, action ModerationAction) error
+	RemoveBan(kind, value string, action ModerationAction) (bool, error)
+	GetBans() ([]Ban, error)
+	IsBanned(username, ip string) (bool, error)
+	SetAccountRole(username, role string, action ModerationAction) (bool, error)
+	GetModerationLog(limit int) ([]ModerationAction, error)
+
+	AddTargetResult(result TargetResult) error
+	GetTargetResults(playerID string) ([]TargetResult, error)
+
+	SaveRun(run Run) error
+	SetRunOwner(runID, username string, accountID int64) error
+	LinkPlayerRunsToAccount(playerID string, accountID int64) error
+	GetRun(runID string) (*Run, error)
+	GetRunTranscript(runID string) ([]byte, error)
+	GetRunsByAccount(accountID int64) ([]Run, error)
+	GetRunsByUsername(username string) ([]Run, error)
+	GetRunsByPlayerID(playerID string) ([]Run, error)
+
+	CreateAccount(username, passwordHash string) (*Account, error)
+	GetAccountByUsername(username string) (*Account, error)
+	GetAccountByFoldedUsername(username string) (*Account, error)
+	CreateAuthSession(token string, accountID int64, expiresAt time.Time) error
+	GetAccountByAuthToken(token string) (*Account, error)
+	DeleteAuthSession(token string) error
+
+	SaveSessions(sessions []*GameSession) error
+	TakeSavedSessions() ([]*GameSession, error)
+
+	SchemaVersion() (int, error)
+	Backup(path string) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var store Store
+
+func OpenStore(config DatabaseConfig) (Store, error) {
+	if config.IsPostgres() {
+		return NewPostgresStore(config.URL)
+	}
+
+	if err := relocateLegacyDatabase(config.Path); err != nil {
+		return nil, fmt.Errorf("failed to move legacy database: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %v", err)
+	}
+
+	return NewSQLiteStore(config.SQLiteDSN())
+}
+
+func NewSQLiteStore(dsn string) (Store, error) {
+	s, err := openSQLStore("sqlite3", dsn, sqliteMigrations)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func NewPostgresStore(databaseURL string) (Store, error) {
+	s, err := openSQLStore("postgres", databaseURL, postgresMigrations)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sqlStore implements Store over database/sql. Queries are written with ? placeholders
+// and in SQL both SQLite and PostgreSQL accept; only the schema migrations differ.
+type sqlStore struct {
+	db     *sql.DB
+	driver string
+}
+
+func openSQLStore(driver, dataSource string, migrations []Migration) (*sqlStore, error) {
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	s := &sqlStore{db: db, driver: driver}
+
+	if err = s.migrate(migrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	return s, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+
+	return false
+}
+
+// rebind rewrites ? placeholders into PostgreSQL's numbered $n form.
+func (s *sqlStore) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+func (s *sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	result, err := s.db.Exec(s.rebind(query), args...)
+	countDBError("exec", err)
+	return result, err
+}
+
+func (s *sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := s.db.Query(s.rebind(query), args...)
+	countDBError("query", err)
+	return rows, err
+}
+
+func (s *sqlStore) queryRow(query string, args ...interface{}) *sql.Row {
+	row := s.db.QueryRow(s.rebind(query), args...)
+	countDBError("query", row.Err())
+	return row
+}
+
+// Backup writes a consistent snapshot of the database to path while it stays online.
+func (s *sqlStore) Backup(path string) error {
+	if s.driver != "sqlite3" {
+		return fmt.Errorf("backups are only supported for SQLite, use pg_dump for PostgreSQL")
+	}
+
+	if _, err := s.exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to back up database to %s: %v", path, err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,1004 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The store tests run every case against SQLite, and against PostgreSQL when TEST_DATABASE_URL
+// points at a database the tests may create schemas in, e.g. postgres://prodle@localhost/prodle_test.
+
+type storeBackend struct {
+	name       string
+	driver     string
+	open       func(t *testing.T) Store
+	migrations []Migration
+}
+
+var storeBackends = []storeBackend{
+	{"sqlite", "sqlite3", openTestSQLiteStore, sqliteMigrations},
+	{"postgres", "postgres", openTestPostgresStore, postgresMigrations},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Helper()
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend.open(t))
+		})
+	}
+}
+
+func openTestSQLiteStore(t *testing.T) Store {
+	t.Helper()
+	config := DatabaseConfig{
+		Path:        filepath.Join(t.TempDir(), "prodle.db"),
+		JournalMode: "WAL",
+		BusyTimeout: 5 * time.Second,
+		ForeignKeys: true,
+	}
+
+	s, err := NewSQLiteStore(config.SQLiteDSN())
+	if err != nil {
+		t.Fatalf("failed to open sqlite store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// openTestPostgresStore gives each test a schema of its own, dropped afterwards.
+func openTestPostgresStore(t *testing.T) Store {
+	t.Helper()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("prodle_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	s, err := NewPostgresStore(withSearchPath(t, databaseURL, schema))
+	if err != nil {
+		t.Fatalf("failed to open postgres store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// withSearchPath sets search_path in either form of connection string lib/pq accepts.
+func withSearchPath(t *testing.T, databaseURL, schema string) string {
+	t.Helper()
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		return databaseURL + " search_path=" + schema
+	}
+
+	parsed, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatalf("invalid TEST_DATABASE_URL: %v", err)
+	}
+	query := parsed.Query()
+	query.Set("search_path", schema)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+func TestStoreSchemaVersion(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.open(t)
+
+			version, err := s.SchemaVersion()
+			if err != nil {
+				t.Fatalf("SchemaVersion: %v", err)
+			}
+			if want := backend.migrations[len(backend.migrations)-1].Version; version != want {
+				t.Errorf("schema version = %d, want %d", version, want)
+			}
+		})
+	}
+}
+
+func addEntry(t *testing.T, s Store, difficulty string, entry LeaderboardEntry) {
+	t.Helper()
+	if entry.Date.IsZero() {
+		entry.Date = time.Now()
+	}
+	if err := s.AddLeaderboardEntryByDifficulty(entry, difficulty); err != nil {
+		t.Fatalf("failed to add entry for %s: %v", entry.Username, err)
+	}
+}
+
+func usernames(entries []LeaderboardEntry) []string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = fmt.Sprintf("%s:%d", entry.Username, entry.Score)
+	}
+	return names
+}
+
+func assertUsernames(t *testing.T, what string, entries []LeaderboardEntry, want ...string) {
+	t.Helper()
+	if got := usernames(entries); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+// seedLeaderboard fills facile with five ranked classic entries, one of them too old for any bounded
+// window, and adds entries every ranking must leave out: hidden, legacy and another difficulty.
+func seedLeaderboard(t *testing.T, s Store) {
+	t.Helper()
+	longAgo := time.Now().AddDate(-2, 0, 0)
+
+	addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "alice", Score: 5000, Duration: 100, RunID: "run-alice-1"})
+	addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "bob", Score: 7000, Duration: 120, RunID: "run-bob"})
+	addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "Alice", Score: 6000, Duration: 90, RunID: "run-alice-2"})
+	addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "carol", Score: 7000, Duration: 110, RunID: "run-carol"})
+	addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "dave", Score: 9000, Duration: 50, Date: longAgo})
+
+	addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "eve", Score: 10000, Duration: 10, RunID: "run-eve", Hidden: true, Suspicion: 80, Flags: FlagSubSecondGuesses + "," + FlagUniformTiming})
+	addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "gina", Score: 9500, Duration: 10, Mode: GameModeLegacy})
+	addEntry(t, s, DifficultyMoyen, LeaderboardEntry{Username: "frank", Score: 8000, Duration: 10, RunID: "run-frank"})
+}
+
+func TestStoreLeaderboardPage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		seedLeaderboard(t, s)
+
+		all, err := s.GetLeaderboardPageByDifficulty(DifficultyFacile, WindowAllTime, ViewAll, 0, 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "all-time page", all, "dave:9000", "carol:7000", "bob:7000", "Alice:6000", "alice:5000")
+		for i, entry := range all {
+			if entry.Rank != i+1 {
+				t.Errorf("%s rank = %d, want %d", entry.Username, entry.Rank, i+1)
+			}
+		}
+
+		page, err := s.GetLeaderboardPageByDifficulty(DifficultyFacile, WindowAllTime, ViewAll, 1, 2)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "second page", page, "carol:7000", "bob:7000")
+		if len(page) == 2 && page[0].Rank != 2 {
+			t.Errorf("first rank on second page = %d, want 2", page[0].Rank)
+		}
+
+		today, err := s.GetLeaderboardPageByDifficulty(DifficultyFacile, WindowToday, ViewAll, 0, 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "today page", today, "carol:7000", "bob:7000", "Alice:6000", "alice:5000")
+
+		best, err := s.GetLeaderboardPageByDifficulty(DifficultyFacile, WindowAllTime, ViewBest, 0, 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "best page", best, "dave:9000", "carol:7000", "bob:7000", "Alice:6000")
+		if len(best) == 4 && best[3].RunCount != 2 {
+			t.Errorf("alice run count = %d, want 2", best[3].RunCount)
+		}
+
+		moyen, err := s.GetLeaderboardPageByDifficulty(DifficultyMoyen, WindowAllTime, ViewAll, 0, 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "moyen page", moyen, "frank:8000")
+
+		if _, err := s.GetLeaderboardPageByDifficulty("impossible", WindowAllTime, ViewAll, 0, 10); err == nil {
+			t.Error("expected an error for an unknown difficulty")
+		}
+	})
+}
+
+// Dates written with far apart offsets would sort the wrong way round as text.
+func TestStoreLeaderboardWindowAcrossZones(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		today, _ := WindowToday.Since(time.Now())
+		east := time.FixedZone("UTC+14", 14*60*60)
+		west := time.FixedZone("UTC-12", -12*60*60)
+
+		addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "yesterday", Score: 2000, Date: today.Add(-time.Minute).In(east)})
+		addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "today", Score: 1000, Date: today.Add(time.Minute).In(west)})
+
+		entries, err := s.GetLeaderboardPageByDifficulty(DifficultyFacile, WindowToday, ViewAll, 0, 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "today page", entries, "today:1000")
+
+		rank, err := s.GetPlayerRankByDifficulty(1500, 0, DifficultyFacile, WindowToday)
+		if err != nil {
+			t.Fatalf("GetPlayerRankByDifficulty: %v", err)
+		}
+		if rank != 1 {
+			t.Errorf("rank today = %d, want 1", rank)
+		}
+	})
+}
+
+func TestStoreLeaderboardCount(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		seedLeaderboard(t, s)
+
+		tests := []struct {
+			window LeaderboardWindow
+			view   LeaderboardView
+			want   int
+		}{
+			{WindowAllTime, ViewAll, 5},
+			{WindowAllTime, ViewBest, 4},
+			{WindowToday, ViewAll, 4},
+			{WindowToday, ViewBest, 3},
+			{WindowSeason, ViewAll, 4},
+		}
+		for _, tt := range tests {
+			count, err := s.CountLeaderboardByDifficulty(DifficultyFacile, tt.window, tt.view)
+			if err != nil {
+				t.Fatalf("CountLeaderboardByDifficulty(%s, %s): %v", tt.window, tt.view, err)
+			}
+			if count != tt.want {
+				t.Errorf("count(%s, %s) = %d, want %d", tt.window, tt.view, count, tt.want)
+			}
+		}
+	})
+}
+
+func TestStoreLeaderboardAroundRun(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		seedLeaderboard(t, s)
+
+		entries, position, err := s.GetLeaderboardAroundRun(DifficultyFacile, WindowAllTime, ViewAll, "run-bob", 1)
+		if err != nil {
+			t.Fatalf("GetLeaderboardAroundRun: %v", err)
+		}
+		if position != 3 {
+			t.Errorf("bob position = %d, want 3", position)
+		}
+		assertUsernames(t, "around bob", entries, "carol:7000", "bob:7000", "Alice:6000")
+
+		// In the best view a run is placed at its owner's best entry.
+		_, position, err = s.GetLeaderboardAroundRun(DifficultyFacile, WindowAllTime, ViewBest, "run-alice-1", 0)
+		if err != nil {
+			t.Fatalf("GetLeaderboardAroundRun: %v", err)
+		}
+		if position != 4 {
+			t.Errorf("alice best position = %d, want 4", position)
+		}
+
+		for _, runID := range []string{"run-eve", "run-frank", "missing"} {
+			entries, position, err := s.GetLeaderboardAroundRun(DifficultyFacile, WindowAllTime, ViewAll, runID, 2)
+			if err != nil {
+				t.Fatalf("GetLeaderboardAroundRun(%s): %v", runID, err)
+			}
+			if position != 0 || len(entries) != 0 {
+				t.Errorf("%s: position %d with %d entries, want none", runID, position, len(entries))
+			}
+		}
+	})
+}
+
+func TestStorePlayerRank(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		seedLeaderboard(t, s)
+
+		tests := []struct {
+			score    int
+			duration int
+			window   LeaderboardWindow
+			want     int
+		}{
+			{20000, 1, WindowAllTime, 1},
+			{7000, 115, WindowAllTime, 3},
+			{7000, 115, WindowToday, 2},
+			{7000, 110, WindowAllTime, 2},
+			{100, 500, WindowAllTime, 6},
+		}
+		for _, tt := range tests {
+			rank, err := s.GetPlayerRankByDifficulty(tt.score, tt.duration, DifficultyFacile, tt.window)
+			if err != nil {
+				t.Fatalf("GetPlayerRankByDifficulty: %v", err)
+			}
+			if rank != tt.want {
+				t.Errorf("rank of %d in %ds (%s) = %d, want %d", tt.score, tt.duration, tt.window, rank, tt.want)
+			}
+		}
+
+		if _, err := s.GetPlayerRankByDifficulty(1000, 10, "impossible", WindowAllTime); err == nil {
+			t.Error("expected an error for an unknown difficulty")
+		}
+	})
+}
+
+func TestStoreLeaderboardInsert(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if err := s.AddLeaderboardEntryByDifficulty(LeaderboardEntry{Username: "alice", Score: 1}, "impossible"); err == nil {
+			t.Error("expected an error for an unknown difficulty")
+		}
+
+		addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "alice", Score: 5000, RunID: "run-1", AccountID: 0})
+		err := s.AddLeaderboardEntryByDifficulty(LeaderboardEntry{Username: "mallory", Score: 9000, Date: time.Now(), RunID: "run-1"}, DifficultyFacile)
+		if !errors.Is(err, ErrRunAlreadySubmitted) {
+			t.Errorf("second submission of a run: err = %v, want ErrRunAlreadySubmitted", err)
+		}
+
+		// Entries without a run are not tied to one another.
+		addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "bob", Score: 3000})
+		addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "bob", Score: 3000})
+
+		count, err := s.CountLeaderboardByDifficulty(DifficultyFacile, WindowAllTime, ViewAll)
+		if err != nil {
+			t.Fatalf("CountLeaderboardByDifficulty: %v", err)
+		}
+		if count != 3 {
+			t.Errorf("count = %d, want 3", count)
+		}
+
+		// They have no run at all rather than an empty one, as imported entries do.
+		var withoutRun int
+		err = s.(*sqlStore).queryRow(`SELECT COUNT(*) FROM leaderboard_entries WHERE run_id IS NULL`).Scan(&withoutRun)
+		if err != nil {
+			t.Fatalf("failed to count entries without a run: %v", err)
+		}
+		if withoutRun != 2 {
+			t.Errorf("entries with a NULL run = %d, want 2", withoutRun)
+		}
+
+		recent, err := s.GetRecentLeaderboardEntries(0, 10)
+		if err != nil {
+			t.Fatalf("GetRecentLeaderboardEntries: %v", err)
+		}
+		if len(recent) != 3 || recent[2].RunID != "run-1" || recent[2].Mode != GameModeClassic {
+			t.Errorf("recent entries = %+v, want the classic run-1 entry last", recent)
+		}
+	})
+}
+
+func TestStoreRuns(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Now().Add(-2 * time.Minute).Truncate(time.Second)
+		run := Run{
+			ID:           "run-1",
+			Difficulty:   DifficultyFacile,
+			Score:        12000,
+			StartTime:    start,
+			EndTime:      start.Add(2 * time.Minute),
+			PlayersFound: 2,
+			Lineup:       []string{"faker", "chovy", "caps"},
+			Targets:      []TargetAttempt{{PlayerID: "faker", StartTime: start, Outcome: TargetFound}},
+			PlayerID:     "player-1",
+			Transcript:   []byte(`{"version":2}`),
+		}
+		if err := s.SaveRun(run); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+		if err := s.SaveRun(Run{ID: "run-2", Difficulty: DifficultyMoyen, StartTime: start, EndTime: start.Add(time.Minute), PlayerID: "player-1"}); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+
+		got, err := s.GetRun("run-1")
+		if err != nil {
+			t.Fatalf("GetRun: %v", err)
+		}
+		if got == nil {
+			t.Fatal("GetRun returned no run")
+		}
+		if got.Score != run.Score || got.PlayersFound != 2 || got.PlayerID != "player-1" || !got.HasTranscript {
+			t.Errorf("run = %+v", got)
+		}
+		if !got.StartTime.Equal(run.StartTime) || !got.EndTime.Equal(run.EndTime) {
+			t.Errorf("run times = %v - %v, want %v - %v", got.StartTime, got.EndTime, run.StartTime, run.EndTime)
+		}
+		if strings.Join(got.Lineup, ",") != "faker,chovy,caps" || len(got.Targets) != 1 || got.Targets[0].Outcome != TargetFound {
+			t.Errorf("run lineup %v and targets %+v", got.Lineup, got.Targets)
+		}
+
+		if missing, err := s.GetRun("missing"); err != nil || missing != nil {
+			t.Errorf("GetRun(missing) = %v, %v, want nil", missing, err)
+		}
+
+		transcript, err := s.GetRunTranscript("run-1")
+		if err != nil || string(transcript) != `{"version":2}` {
+			t.Errorf("GetRunTranscript = %q, %v", transcript, err)
+		}
+		if transcript, err := s.GetRunTranscript("run-2"); err != nil || transcript != nil {
+			t.Errorf("GetRunTranscript without transcript = %q, %v, want nil", transcript, err)
+		}
+
+		if err := s.SetRunOwner("run-1", "Alice", 0); err != nil {
+			t.Fatalf("SetRunOwner: %v", err)
+		}
+		byName, err := s.GetRunsByUsername("alice")
+		if err != nil {
+			t.Fatalf("GetRunsByUsername: %v", err)
+		}
+		if len(byName) != 1 || byName[0].ID != "run-1" || byName[0].Username != "Alice" {
+			t.Errorf("runs by username = %+v", byName)
+		}
+
+		byPlayer, err := s.GetRunsByPlayerID("player-1")
+		if err != nil {
+			t.Fatalf("GetRunsByPlayerID: %v", err)
+		}
+		if len(byPlayer) != 2 || byPlayer[0].ID != "run-2" {
+			t.Errorf("runs by player should be both, oldest end first: %+v", byPlayer)
+		}
+
+		account, err := s.CreateAccount("alice", "hash")
+		if err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+		if err := s.LinkPlayerRunsToAccount("player-1", account.ID); err != nil {
+			t.Fatalf("LinkPlayerRunsToAccount: %v", err)
+		}
+
+		byAccount, err := s.GetRunsByAccount(account.ID)
+		if err != nil {
+			t.Fatalf("GetRunsByAccount: %v", err)
+		}
+		if len(byAccount) != 2 {
+			t.Errorf("runs by account = %d, want 2", len(byAccount))
+		}
+
+		// Runs owned by an account are no longer listed under the bare username.
+		byName, err = s.GetRunsByUsername("alice")
+		if err != nil {
+			t.Fatalf("GetRunsByUsername: %v", err)
+		}
+		if len(byName) != 0 {
+			t.Errorf("runs by username after linking = %d, want 0", len(byName))
+		}
+	})
+}
+
+// Runs kept off the leaderboard must not reach profiles either, where they would show as personal bests.
+func TestStoreHiddenRuns(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Now().Add(-time.Hour).Truncate(time.Second)
+		submit := func(id string, score int, flagged bool) {
+			t.Helper()
+			run := Run{ID: id, Difficulty: DifficultyFacile, Score: score, StartTime: start, EndTime: start, PlayerID: "player-1", Hidden: flagged}
+			if err := s.SaveRun(run); err != nil {
+				t.Fatalf("SaveRun: %v", err)
+			}
+			addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "mallory", Score: score, RunID: id, Hidden: flagged})
+			if err := s.SetRunOwner(id, "mallory", 0); err != nil {
+				t.Fatalf("SetRunOwner: %v", err)
+			}
+		}
+		submit("run-honest", 3000, false)
+		submit("run-flagged", 20000, true)
+		submit("run-hidden", 15000, false)
+		submit("run-deleted", 12000, false)
+
+		ids := make(map[string]int64)
+		recent, err := s.GetRecentLeaderboardEntries(0, 10)
+		if err != nil {
+			t.Fatalf("GetRecentLeaderboardEntries: %v", err)
+		}
+		for _, entry := range recent {
+			ids[entry.RunID] = entry.ID
+		}
+
+		action := ModerationAction{Actor: "mod", Action: "hide", Target: "mallory"}
+		if changed, err := s.SetLeaderboardEntryHidden(ids["run-hidden"], true, action); err != nil || !changed {
+			t.Fatalf("SetLeaderboardEntryHidden = %v, %v", changed, err)
+		}
+		action = ModerationAction{Actor: "mod", Action: "delete", Target: "mallory"}
+		if changed, err := s.DeleteLeaderboardEntry(ids["run-deleted"], action); err != nil || !changed {
+			t.Fatalf("DeleteLeaderboardEntry = %v, %v", changed, err)
+		}
+
+		assertRuns := func(what string, want ...string) {
+			t.Helper()
+			byName, err := s.GetRunsByUsername("mallory")
+			if err != nil {
+				t.Fatalf("GetRunsByUsername: %v", err)
+			}
+			byPlayer, err := s.GetRunsByPlayerID("player-1")
+			if err != nil {
+				t.Fatalf("GetRunsByPlayerID: %v", err)
+			}
+			for _, runs := range [][]Run{byName, byPlayer} {
+				var got []string
+				for _, run := range runs {
+					got = append(got, run.ID)
+				}
+				slices.Sort(got)
+				if strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Errorf("%s = %v, want %v", what, got, want)
+				}
+			}
+		}
+		assertRuns("runs after moderation", "run-honest")
+
+		// A moderator clearing a flagged entry puts its run back on the profile.
+		action = ModerationAction{Actor: "mod", Action: "unhide", Target: "mallory"}
+		if changed, err := s.SetLeaderboardEntryHidden(ids["run-flagged"], false, action); err != nil || !changed {
+			t.Fatalf("SetLeaderboardEntryHidden = %v, %v", changed, err)
+		}
+		assertRuns("runs after review", "run-flagged", "run-honest")
+
+		// The run page itself still loads, for moderators following a link.
+		if run, err := s.GetRun("run-deleted"); err != nil || run == nil || !run.Hidden {
+			t.Errorf("GetRun(run-deleted) = %+v, %v, want the hidden run", run, err)
+		}
+	})
+}
+
+func TestStoreTargetResults(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Now().Truncate(time.Second)
+		results := []TargetResult{
+			{SessionID: "s1", Difficulty: DifficultyFacile, PlayerID: "faker", Found: true, StartTime: start, EndTime: start.Add(time.Second),
+				Guesses: []TargetGuess{{PlayerID: "chovy", Exact: []string{"role"}}, {PlayerID: "faker"}}},
+			{SessionID: "s2", Difficulty: DifficultyMoyen, PlayerID: "chovy", StartTime: start, EndTime: start.Add(time.Second)},
+		}
+		for _, result := range results {
+			if err := s.AddTargetResult(result); err != nil {
+				t.Fatalf("AddTargetResult: %v", err)
+			}
+		}
+
+		all, err := s.GetTargetResults("")
+		if err != nil {
+			t.Fatalf("GetTargetResults: %v", err)
+		}
+		if len(all) != 2 {
+			t.Errorf("all target results = %d, want 2", len(all))
+		}
+
+		faker, err := s.GetTargetResults("faker")
+		if err != nil {
+			t.Fatalf("GetTargetResults: %v", err)
+		}
+		if len(faker) != 1 || !faker[0].Found || len(faker[0].Guesses) != 2 || faker[0].Guesses[0].Exact[0] != "role" {
+			t.Errorf("faker results = %+v", faker)
+		}
+	})
+}
+
+func TestStoreAccounts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		account, err := s.CreateAccount("Zoe", "hash")
+		if err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+		if account.ID == 0 || account.Role != AccountRolePlayer {
+			t.Errorf("account = %+v", account)
+		}
+
+		if _, err := s.CreateAccount("ZOE", "other"); err == nil {
+			t.Error("expected usernames to be unique regardless of case")
+		}
+
+		got, err := s.GetAccountByUsername("zoe")
+		if err != nil {
+			t.Fatalf("GetAccountByUsername: %v", err)
+		}
+		if got == nil || got.ID != account.ID || got.Username != "Zoe" || got.PasswordHash != "hash" {
+			t.Errorf("account by username = %+v", got)
+		}
+
+		if missing, err := s.GetAccountByUsername("nobody"); err != nil || missing != nil {
+			t.Errorf("GetAccountByUsername(nobody) = %v, %v, want nil", missing, err)
+		}
+
+		bobby, err := s.CreateAccount("Bobby", "hash")
+		if err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+		for _, lookalike := range []string{"bobby", "B0bby", "B o b b y", "b.o.b.b.y"} {
+			got, err := s.GetAccountByFoldedUsername(lookalike)
+			if err != nil {
+				t.Fatalf("GetAccountByFoldedUsername(%s): %v", lookalike, err)
+			}
+			if got == nil || got.ID != bobby.ID {
+				t.Errorf("account folding like %s = %+v, want Bobby", lookalike, got)
+			}
+		}
+		if missing, err := s.GetAccountByFoldedUsername("Bob"); err != nil || missing != nil {
+			t.Errorf("GetAccountByFoldedUsername(Bob) = %v, %v, want nil", missing, err)
+		}
+		if _, err := s.CreateAccount("B0bby", "other"); err != ErrUsernameTaken {
+			t.Errorf("CreateAccount(B0bby) = %v, want ErrUsernameTaken", err)
+		}
+
+		if err := s.CreateAuthSession("valid-token", account.ID, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("CreateAuthSession: %v", err)
+		}
+		if err := s.CreateAuthSession("expired-token", account.ID, time.Now().Add(-time.Hour)); err != nil {
+			t.Fatalf("CreateAuthSession: %v", err)
+		}
+
+		authenticated, err := s.GetAccountByAuthToken("valid-token")
+		if err != nil {
+			t.Fatalf("GetAccountByAuthToken: %v", err)
+		}
+		if authenticated == nil || authenticated.ID != account.ID {
+			t.Errorf("account by valid token = %+v", authenticated)
+		}
+
+		for _, token := range []string{"expired-token", "unknown-token", hashAuthToken("valid-token")} {
+			if got, err := s.GetAccountByAuthToken(token); err != nil || got != nil {
+				t.Errorf("GetAccountByAuthToken(%s) = %v, %v, want nil", token, got, err)
+			}
+		}
+
+		if err := s.DeleteAuthSession("valid-token"); err != nil {
+			t.Fatalf("DeleteAuthSession: %v", err)
+		}
+		if got, err := s.GetAccountByAuthToken("valid-token"); err != nil || got != nil {
+			t.Errorf("GetAccountByAuthToken after logout = %v, %v, want nil", got, err)
+		}
+	})
+}
+
+func TestStoreBans(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		admin := func(action, target string) ModerationAction {
+			return ModerationAction{Actor: "admin", Action: action, Target: target}
+		}
+
+		if err := s.AddBan(Ban{Kind: BanUsername, Value: "bob", Reason: "spam", CreatedBy: "admin"}, admin("ban", "bob")); err != nil {
+			t.Fatalf("AddBan: %v", err)
+		}
+		if err := s.AddBan(Ban{Kind: BanIP, Value: "203.0.113.7", Reason: "bot", CreatedBy: "admin"}, admin("ban", "203.0.113.7")); err != nil {
+			t.Fatalf("AddBan: %v", err)
+		}
+		if err := s.AddBan(Ban{Kind: BanUsername, Value: "bob", Reason: "repeat spam", CreatedBy: "admin"}, admin("ban", "bob")); err != nil {
+			t.Fatalf("AddBan again: %v", err)
+		}
+
+		bans, err := s.GetBans()
+		if err != nil {
+			t.Fatalf("GetBans: %v", err)
+		}
+		if len(bans) != 2 {
+			t.Fatalf("bans = %+v, want 2", bans)
+		}
+		for _, ban := range bans {
+			if ban.Kind == BanUsername && ban.Reason != "repeat spam" {
+				t.Errorf("username ban reason = %q, want it replaced", ban.Reason)
+			}
+		}
+
+		tests := []struct {
+			username string
+			ip       string
+			want     bool
+		}{
+			{"bob", "198.51.100.1", true},
+			{" Bob ", "198.51.100.1", true},
+			{"B0b", "198.51.100.1", true},
+			{"carl", "203.0.113.7", true},
+			{"carl", "198.51.100.1", false},
+		}
+		for _, tt := range tests {
+			banned, err := s.IsBanned(tt.username, tt.ip)
+			if err != nil {
+				t.Fatalf("IsBanned: %v", err)
+			}
+			if banned != tt.want {
+				t.Errorf("IsBanned(%q, %q) = %v, want %v", tt.username, tt.ip, banned, tt.want)
+			}
+		}
+
+		removed, err := s.RemoveBan(BanUsername, "bob", admin("unban", "bob"))
+		if err != nil || !removed {
+			t.Fatalf("RemoveBan = %v, %v", removed, err)
+		}
+		if removed, err := s.RemoveBan(BanUsername, "bob", admin("unban", "bob")); err != nil || removed {
+			t.Errorf("RemoveBan of a missing ban = %v, %v, want false", removed, err)
+		}
+		if banned, err := s.IsBanned("bob", "198.51.100.1"); err != nil || banned {
+			t.Errorf("IsBanned after unban = %v, %v", banned, err)
+		}
+
+		log, err := s.GetModerationLog(10)
+		if err != nil {
+			t.Fatalf("GetModerationLog: %v", err)
+		}
+		// The failed second unban matched nothing and is not logged.
+		if len(log) != 4 || log[0].Action != "unban" || log[0].Actor != "admin" || log[3].Target != "bob" {
+			t.Errorf("moderation log = %+v", log)
+		}
+	})
+}
+
+func TestStoreModeration(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		seedLeaderboard(t, s)
+
+		recent, err := s.GetRecentLeaderboardEntries(0, 100)
+		if err != nil {
+			t.Fatalf("GetRecentLeaderboardEntries: %v", err)
+		}
+		if len(recent) != 8 {
+			t.Fatalf("recent entries = %d, want hidden and legacy entries included", len(recent))
+		}
+
+		ids := make(map[string]int64)
+		for _, entry := range recent {
+			ids[entry.Username] = entry.ID
+		}
+
+		action := ModerationAction{Actor: "mod", Action: "hide", Target: "dave"}
+		if changed, err := s.SetLeaderboardEntryHidden(ids["dave"], true, action); err != nil || !changed {
+			t.Fatalf("SetLeaderboardEntryHidden = %v, %v", changed, err)
+		}
+		entry, err := s.GetLeaderboardEntry(ids["dave"])
+		if err != nil || entry == nil || !entry.Hidden {
+			t.Errorf("hidden entry = %+v, %v", entry, err)
+		}
+
+		action = ModerationAction{Actor: "mod", Action: "unhide", Target: "eve"}
+		if changed, err := s.SetLeaderboardEntryHidden(ids["eve"], false, action); err != nil || !changed {
+			t.Fatalf("SetLeaderboardEntryHidden = %v, %v", changed, err)
+		}
+
+		action = ModerationAction{Actor: "mod", Action: "delete", Target: "bob"}
+		if deleted, err := s.DeleteLeaderboardEntry(ids["bob"], action); err != nil || !deleted {
+			t.Fatalf("DeleteLeaderboardEntry = %v, %v", deleted, err)
+		}
+		if entry, err := s.GetLeaderboardEntry(ids["bob"]); err != nil || entry != nil {
+			t.Errorf("deleted entry = %+v, %v, want nil", entry, err)
+		}
+		if deleted, err := s.DeleteLeaderboardEntry(ids["bob"], action); err != nil || deleted {
+			t.Errorf("deleting twice = %v, %v, want false", deleted, err)
+		}
+
+		page, err := s.GetLeaderboardPageByDifficulty(DifficultyFacile, WindowAllTime, ViewAll, 0, 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "moderated page", page, "eve:10000", "carol:7000", "Alice:6000", "alice:5000")
+
+		if _, err := s.CreateAccount("Zoe", "hash"); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+		action = ModerationAction{Actor: "mod", Action: "set_role", Target: "zoe", Details: AccountRoleAdmin}
+		if changed, err := s.SetAccountRole("zoe", AccountRoleAdmin, action); err != nil || !changed {
+			t.Fatalf("SetAccountRole = %v, %v", changed, err)
+		}
+		if account, err := s.GetAccountByUsername("zoe"); err != nil || account.Role != AccountRoleAdmin {
+			t.Errorf("account after SetAccountRole = %+v, %v", account, err)
+		}
+		if changed, err := s.SetAccountRole("nobody", AccountRoleAdmin, action); err != nil || changed {
+			t.Errorf("SetAccountRole(nobody) = %v, %v, want false", changed, err)
+		}
+
+		log, err := s.GetModerationLog(2)
+		if err != nil {
+			t.Fatalf("GetModerationLog: %v", err)
+		}
+		if len(log) != 2 || log[0].Action != "set_role" || log[0].Details != AccountRoleAdmin || log[1].Action != "delete" {
+			t.Errorf("moderation log = %+v", log)
+		}
+	})
+}
+
+func TestStoreImportExport(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		seedLeaderboard(t, s)
+
+		exported, err := s.ExportLeaderboardEntries(LeaderboardFilter{Difficulty: DifficultyFacile})
+		if err != nil {
+			t.Fatalf("ExportLeaderboardEntries: %v", err)
+		}
+		if len(exported) != 7 {
+			t.Fatalf("exported %d facile entries, want all 7, hidden included", len(exported))
+		}
+		if exported[0].Username != "dave" {
+			t.Errorf("first exported entry = %s, want the oldest", exported[0].Username)
+		}
+
+		visible, err := s.ExportLeaderboardEntries(LeaderboardFilter{Difficulty: DifficultyFacile, VisibleOnly: true})
+		if err != nil {
+			t.Fatalf("ExportLeaderboardEntries: %v", err)
+		}
+		if len(visible) != 6 {
+			t.Errorf("exported %d visible facile entries, want 6", len(visible))
+		}
+
+		recent, err := s.ExportLeaderboardEntries(LeaderboardFilter{From: time.Now().AddDate(0, 0, -1)})
+		if err != nil {
+			t.Fatalf("ExportLeaderboardEntries: %v", err)
+		}
+		if len(recent) != 7 {
+			t.Errorf("exported %d entries since yesterday, want 7", len(recent))
+		}
+
+		importAction := ModerationAction{Actor: "admin", Action: "import", Target: "leaderboard"}
+
+		// Importing what is already there adds nothing, and is not logged.
+		imported, err := s.ImportLeaderboardEntries(exported, importAction)
+		if err != nil {
+			t.Fatalf("ImportLeaderboardEntries: %v", err)
+		}
+		if imported != 0 {
+			t.Errorf("re-imported %d entries, want 0", imported)
+		}
+		if log, err := s.GetModerationLog(10); err != nil || len(log) != 0 {
+			t.Errorf("moderation log after an empty import = %+v, %v", log, err)
+		}
+
+		target := openTargetStore(t, s)
+		start := time.Now().Truncate(time.Second)
+		if err := target.SaveRun(Run{ID: "run-bob", Difficulty: DifficultyFacile, StartTime: start, EndTime: start}); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+
+		imported, err = target.ImportLeaderboardEntries(exported, importAction)
+		if err != nil {
+			t.Fatalf("ImportLeaderboardEntries: %v", err)
+		}
+		if imported != 7 {
+			t.Errorf("imported %d entries, want 7", imported)
+		}
+
+		// Entries whose run is not kept are still recognised on a second import.
+		if imported, err := target.ImportLeaderboardEntries(exported, importAction); err != nil || imported != 0 {
+			t.Errorf("second import = %d, %v, want 0", imported, err)
+		}
+
+		log, err := target.GetModerationLog(10)
+		if err != nil {
+			t.Fatalf("GetModerationLog: %v", err)
+		}
+		if len(log) != 1 || log[0].Actor != "admin" || log[0].Action != "import" || log[0].Details != "7 of 7 entries" {
+			t.Errorf("moderation log after import = %+v", log)
+		}
+
+		entries, err := target.GetRecentLeaderboardEntries(0, 10)
+		if err != nil {
+			t.Fatalf("GetRecentLeaderboardEntries: %v", err)
+		}
+		for _, entry := range entries {
+			// Only runs that exist in the target keep their link.
+			if want := map[string]string{"bob": "run-bob"}[entry.Username]; entry.RunID != want {
+				t.Errorf("%s imported with run %q, want %q", entry.Username, entry.RunID, want)
+			}
+			// The moderation queue comes across with its verdicts.
+			if entry.Username == "eve" && (!entry.Hidden || entry.Suspicion != 80 || entry.Flags != FlagSubSecondGuesses+","+FlagUniformTiming) {
+				t.Errorf("eve imported as hidden %v, suspicion %d, flags %q", entry.Hidden, entry.Suspicion, entry.Flags)
+			}
+		}
+
+		page, err := target.GetLeaderboardPageByDifficulty(DifficultyFacile, WindowAllTime, ViewAll, 0, 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboardPageByDifficulty: %v", err)
+		}
+		assertUsernames(t, "imported page", page, "dave:9000", "carol:7000", "bob:7000", "Alice:6000", "alice:5000")
+	})
+}
+
+func TestStoreImportDuplicates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		action := ModerationAction{Actor: "admin", Action: "import", Target: "leaderboard"}
+		start := time.Now().Truncate(time.Second)
+		if err := s.SaveRun(Run{ID: "run-1", Difficulty: DifficultyFacile, StartTime: start, EndTime: start}); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+		addEntry(t, s, DifficultyFacile, LeaderboardEntry{Username: "alice", Score: 5000, Date: start, RunID: "run-1"})
+
+		// A date finer than the database keeps, as a file written elsewhere may carry.
+		precise := time.Date(2025, 3, 14, 15, 9, 26, 535897932, time.UTC)
+		entries := []LeaderboardEntry{
+			{Difficulty: DifficultyFacile, Username: "alice", Score: 5000, Date: start.Add(time.Hour), RunID: "run-1"},
+			{Difficulty: DifficultyFacile, Username: "bob", Score: 4000, Date: precise},
+			{Difficulty: DifficultyFacile, Username: "bob", Score: 4000, Date: precise},
+		}
+
+		imported, err := s.ImportLeaderboardEntries(entries, action)
+		if err != nil {
+			t.Fatalf("ImportLeaderboardEntries: %v", err)
+		}
+		if imported != 1 {
+			t.Errorf("imported %d entries, want only bob's once", imported)
+		}
+
+		imported, err = s.ImportLeaderboardEntries(entries, action)
+		if err != nil {
+			t.Fatalf("ImportLeaderboardEntries: %v", err)
+		}
+		if imported != 0 {
+			t.Errorf("re-imported %d entries, want 0", imported)
+		}
+	})
+}
+
+// openTargetStore opens a second, empty store on the same backend as s.
+func openTargetStore(t *testing.T, s Store) Store {
+	t.Helper()
+	for _, backend := range storeBackends {
+		if backend.driver == s.(*sqlStore).driver {
+			return backend.open(t)
+		}
+	}
+	t.Fatalf("no test backend for driver %s", s.(*sqlStore).driver)
+	return nil
+}
+
+func TestStoreSavedSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Now().Truncate(time.Second)
+		first := &GameSession{
+			SessionID:         "session-1",
+			Difficulty:        DifficultyFacile,
+			Settings:          DefaultGameSettings,
+			Score:             4200,
+			StartTime:         start,
+			Targets:           []TargetAttempt{{PlayerID: "faker", StartTime: start, Outcome: TargetPending}},
+			PlayerID:          "player-1",
+			AccountID:         7,
+			AutocompleteTimes: []time.Time{start.Add(time.Second)},
+			Analysis:          &RunAnalysis{},
+		}
+		second := &GameSession{SessionID: "session-2", Difficulty: DifficultyMoyen, StartTime: start}
+
+		if err := s.SaveSessions([]*GameSession{first}); err != nil {
+			t.Fatalf("SaveSessions: %v", err)
+		}
+		// Saving again replaces the earlier save.
+		if err := s.SaveSessions([]*GameSession{first, second}); err != nil {
+			t.Fatalf("SaveSessions: %v", err)
+		}
+
+		sessions, err := s.TakeSavedSessions()
+		if err != nil {
+			t.Fatalf("TakeSavedSessions: %v", err)
+		}
+		if len(sessions) != 2 {
+			t.Fatalf("restored %d sessions, want 2", len(sessions))
+		}
+
+		var restored *GameSession
+		for _, session := range sessions {
+			if session.SessionID == "session-1" {
+				restored = session
+			}
+		}
+		if restored == nil {
+			t.Fatal("session-1 was not restored")
+		}
+		if restored.Score != 4200 || restored.PlayerID != "player-1" || restored.AccountID != 7 || restored.Analysis == nil {
+			t.Errorf("restored session = %+v", restored)
+		}
+		if restored.Settings != DefaultGameSettings || !restored.StartTime.Equal(start) || len(restored.Targets) != 1 {
+			t.Errorf("restored settings %+v, start %v, targets %+v", restored.Settings, restored.StartTime, restored.Targets)
+		}
+		if len(restored.AutocompleteTimes) != 1 || !restored.AutocompleteTimes[0].Equal(start.Add(time.Second)) {
+			t.Errorf("restored autocomplete times = %v", restored.AutocompleteTimes)
+		}
+
+		sessions, err = s.TakeSavedSessions()
+		if err != nil {
+			t.Fatalf("TakeSavedSessions: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("sessions restored twice: %d", len(sessions))
+		}
+	})
+}
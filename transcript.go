@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	transcriptVersion     = 2
+	transcriptAlgorithm   = "Ed25519"
+	transcriptKeyFileName = "transcript_ed25519.pem"
+)
+
+const (
+	LedgerTarget          = "target"
+	LedgerCompletionBonus = "completion_bonus"
+)
+
+type TranscriptGuess struct {
+	PlayerID  string    `json:"player_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Correct   bool      `json:"correct"`
+}
+
+type TranscriptTarget struct {
+	PlayerID  string            `json:"player_id"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   *time.Time        `json:"end_time,omitempty"`
+	Outcome   TargetOutcome     `json:"outcome"`
+	Guesses   []TranscriptGuess `json:"guesses"`
+}
+
+// ScoreLedgerEntry is one line of a run's score: the points for a found target (numbered from 1),
+// or the bonus for finding the whole lineup.
+type ScoreLedgerEntry struct {
+	Reason         string `json:"reason"`
+	Target         int    `json:"target,omitempty"`
+	ElapsedSeconds int    `json:"elapsed_seconds,omitempty"`
+	WrongGuesses   int    `json:"wrong_guesses,omitempty"`
+	Points         int    `json:"points"`
+}
+
+type RunTranscript struct {
+	Version    int                `json:"version"`
+	RunID      string             `json:"run_id"`
+	Difficulty string             `json:"difficulty"`
+	TimeLimit  int                `json:"time_limit"`
+	Scoring    ScoringSettings    `json:"scoring"`
+	StartTime  time.Time          `json:"start_time"`
+	EndTime    time.Time          `json:"end_time"`
+	Lineup     []string           `json:"lineup"`
+	Targets    []TranscriptTarget `json:"targets"`
+	Ledger     []ScoreLedgerEntry `json:"ledger"`
+	Score      int                `json:"score"`
+}
+
+// SignedTranscript signs the compact JSON encoding of the transcript. Verifiers compact the transcript
+// before checking it, so the file may be pretty-printed, but must not be re-encoded otherwise.
+type SignedTranscript struct {
+	Transcript json.RawMessage `json:"transcript"`
+	Algorithm  string          `json:"algorithm"`
+	KeyID      string          `json:"key_id"`
+	Signature  string          `json:"signature"`
+}
+
+type TranscriptKeyResponse struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId"`
+	PublicKey string `json:"publicKey"`
+	PEM       string `json:"pem"`
+}
+
+type TranscriptSigner struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+var transcriptSigner *TranscriptSigner
+
+func transcriptKeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+func transcriptKeyPath(config DatabaseConfig) string {
+	if path := os.Getenv("TRANSCRIPT_KEY"); path != "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(config.Path), transcriptKeyFileName)
+}
+
+func readTranscriptKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM private key", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// LoadTranscriptSigner reads the signing key from TRANSCRIPT_KEY, next to the database by default,
+// creating one on first start. Back the key up with the database: losing it orphans every signature.
+func LoadTranscriptSigner(config DatabaseConfig) (*TranscriptSigner, error) {
+	path := transcriptKeyPath(config)
+
+	key, err := readTranscriptKey(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = createTranscriptKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transcript key: %v", err)
+	}
+
+	signer := &TranscriptSigner{key: key, keyID: transcriptKeyID(key.Public().(ed25519.PublicKey))}
+	slog.Info("Signing run transcripts", "key_id", signer.keyID)
+	return signer, nil
+}
+
+func createTranscriptKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Created transcript signing key", "path", path)
+	return key, nil
+}
+
+func (s *TranscriptSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+func (s *TranscriptSigner) Sign(transcript RunTranscript) ([]byte, error) {
+	payload, err := json.Marshal(transcript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transcript: %v", err)
+	}
+
+	signed := SignedTranscript{
+		Transcript: payload,
+		Algorithm:  transcriptAlgorithm,
+		KeyID:      s.keyID,
+		Signature:  base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload)),
+	}
+	return json.MarshalIndent(signed, "", "  ")
+}
+
+// ScoreLedger recomputes a run's score from its targets, with the same rules the game applied live.
+func ScoreLedger(settings GameSettings, startTime time.Time, lineupSize int, targets []TranscriptTarget) ([]ScoreLedgerEntry, int) {
+	ledger := make([]ScoreLedgerEntry, 0, len(targets)+1)
+	total, found := 0, 0
+
+	for i, target := range targets {
+		if target.Outcome != TargetFound || len(target.Guesses) == 0 {
+			continue
+		}
+
+		found++
+		correct := target.Guesses[len(target.Guesses)-1]
+		entry := ScoreLedgerEntry{
+			Reason:         LedgerTarget,
+			Target:         i + 1,
+			ElapsedSeconds: ElapsedSeconds(startTime, correct.Timestamp),
+			WrongGuesses:   len(target.Guesses) - 1,
+		}
+		entry.Points = CalculatePlayerPoints(settings, entry.ElapsedSeconds, entry.WrongGuesses)
+		total += entry.Points
+		ledger = append(ledger, entry)
+	}
+
+	if EarnsCompletionBonus(found, lineupSize) {
+		bonus := settings.Scoring.CompletionBonus
+		ledger = append(ledger, ScoreLedgerEntry{Reason: LedgerCompletionBonus, Points: bonus})
+		total += bonus
+	}
+
+	return ledger, total
+}
+
+func (gs *GameSession) BuildTranscript(ctx context.Context, runID string) RunTranscript {
+	run := gs.BuildRun()
+
+	targets := make([]TranscriptTarget, len(gs.Targets))
+	for i, target := range gs.Targets {
+		guesses := make([]TranscriptGuess, len(target.Guesses))
+		for j, guess := range target.Guesses {
+			guesses[j] = TranscriptGuess{
+				PlayerID:  guess.GuessedPlayer.ID,
+				Timestamp: guess.Timestamp,
+				Correct:   guess.IsCorrect,
+			}
+		}
+
+		targets[i] = TranscriptTarget{
+			PlayerID:  target.PlayerID,
+			StartTime: target.StartTime,
+			EndTime:   target.EndTime,
+			Outcome:   target.Outcome,
+			Guesses:   guesses,
+		}
+	}
+
+	ledger, total := ScoreLedger(gs.Settings, gs.StartTime, len(run.Lineup), targets)
+	if total != gs.Score {
+		slog.WarnContext(ctx, "Transcript score differs from session score", "run", runID, "recomputed", total, "score", gs.Score)
+	}
+
+	return RunTranscript{
+		Version:    transcriptVersion,
+		RunID:      runID,
+		Difficulty: gs.Difficulty,
+		TimeLimit:  gs.Settings.TotalGameTimeSeconds,
+		Scoring:    gs.Settings.Scoring,
+		StartTime:  gs.StartTime,
+		EndTime:    run.EndTime,
+		Lineup:     run.Lineup,
+		Targets:    targets,
+		Ledger:     ledger,
+		Score:      gs.Score,
+	}
+}
+
+// VerifyTranscript checks the signature, that the transcript is internally consistent,
+// and that its ledger and score match what the scoring code computes from the guesses.
+func VerifyTranscript(data []byte, public ed25519.PublicKey) (*RunTranscript, error) {
+	var signed SignedTranscript
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("invalid transcript file: %v", err)
+	}
+
+	if signed.Algorithm != transcriptAlgorithm {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", signed.Algorithm)
+	}
+	if keyID := transcriptKeyID(public); signed.KeyID != keyID {
+		return nil, fmt.Errorf("transcript was signed with key %s, not %s", signed.KeyID, keyID)
+	}
+
+	var payload bytes.Buffer
+	if err := json.Compact(&payload, signed.Transcript); err != nil {
+		return nil, fmt.Errorf("invalid transcript: %v", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(public, payload.Bytes(), signature) {
+		return nil, fmt.Errorf("signature does not match the transcript")
+	}
+
+	var transcript RunTranscript
+	if err := json.Unmarshal(signed.Transcript, &transcript); err != nil {
+		return nil, fmt.Errorf("invalid transcript: %v", err)
+	}
+
+	if transcript.Version < 1 || transcript.Version > transcriptVersion {
+		return nil, fmt.Errorf("unsupported transcript version %d", transcript.Version)
+	}
+
+	// The transcript carries the rules it was scored with; version 1 predates configurable scoring
+	settings := GameSettings{
+		TotalGameTimeSeconds: transcript.TimeLimit,
+		PlayersPerSession:    len(transcript.Lineup),
+		Scoring:              transcript.Scoring,
+	}
+	if transcript.Version == 1 {
+		settings.Scoring = DefaultGameSettings.Scoring
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid transcript rules: %v", err)
+	}
+
+	if err := checkTranscriptTargets(&transcript); err != nil {
+		return nil, err
+	}
+
+	ledger, total := ScoreLedger(settings, transcript.StartTime, len(transcript.Lineup), transcript.Targets)
+	if !slices.Equal(ledger, transcript.Ledger) {
+		return nil, fmt.Errorf("score ledger does not match the guesses")
+	}
+	if total != transcript.Score {
+		return nil, fmt.Errorf("score %d does not match the recomputed %d", transcript.Score, total)
+	}
+
+	return &transcript, nil
+}
+
+func checkTranscriptTargets(transcript *RunTranscript) error {
+	if len(transcript.Targets) > len(transcript.Lineup) {
+		return fmt.Errorf("transcript has %d targets for a lineup of %d", len(transcript.Targets), len(transcript.Lineup))
+	}
+
+	previous := transcript.StartTime
+	for i, target := range transcript.Targets {
+		if target.PlayerID != transcript.Lineup[i] {
+			return fmt.Errorf("target %d is %s, lineup says %s", i+1, target.PlayerID, transcript.Lineup[i])
+		}
+
+		for j, guess := range target.Guesses {
+			if guess.Timestamp.Before(previous) {
+				return fmt.Errorf("target %d guess %d is out of order", i+1, j+1)
+			}
+			previous = guess.Timestamp
+
+			last := j == len(target.Guesses)-1
+			if guess.Correct != (guess.PlayerID == target.PlayerID) || (guess.Correct && !last) {
+				return fmt.Errorf("target %d guess %d is inconsistent", i+1, j+1)
+			}
+		}
+
+		solved := len(target.Guesses) > 0 && target.Guesses[len(target.Guesses)-1].Correct
+		if solved != (target.Outcome == TargetFound) {
+			return fmt.Errorf("target %d outcome %s does not match its guesses", i+1, target.Outcome)
+		}
+	}
+
+	return nil
+}
+
+// parseTranscriptPublicKey accepts a base64 Ed25519 public key, as served by /api/transcripts/key,
+// or the path to a PEM public key.
+func parseTranscriptPublicKey(value string) (ed25519.PublicKey, error) {
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(raw), nil
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a base64 public key nor a readable file", value)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s is not a PEM public key", value)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", value, err)
+	}
+
+	public, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", value)
+	}
+	return public, nil
+}
+
+func runVerifyCommand(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	keyValue := flags.String("key", "", "base64 public key or PEM public key file (default the local signing key)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: prodle verify [-key public-key] <transcript.json>")
+	}
+
+	var public ed25519.PublicKey
+	if *keyValue != "" {
+		key, err := parseTranscriptPublicKey(*keyValue)
+		if err != nil {
+			return err
+		}
+		public = key
+	} else {
+		config, err := LoadDatabaseConfig()
+		if err != nil {
+			return err
+		}
+		key, err := readTranscriptKey(transcriptKeyPath(config))
+		if err != nil {
+			return fmt.Errorf("no -key given and the local signing key is unavailable: %v", err)
+		}
+		public = key.Public().(ed25519.PublicKey)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read transcript: %v", err)
+	}
+
+	transcript, err := VerifyTranscript(data, public)
+	if err != nil {
+		return err
+	}
+
+	found := 0
+	for _, target := range transcript.Targets {
+		if target.Outcome == TargetFound {
+			found++
+		}
+	}
+
+	fmt.Printf("OK run %s (%s): %d points, %d/%d players found, signed by key %s\n",
+		transcript.RunID, transcript.Difficulty, transcript.Score, found, len(transcript.Lineup), transcriptKeyID(public))
+	return nil
+}
+
+func transcriptKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if transcriptSigner == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	public := transcriptSigner.PublicKey()
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		http.Error(w, "Error encoding public key", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error encoding transcript public key", "error", err)
+		return
+	}
+
+	response := TranscriptKeyResponse{
+		Algorithm: transcriptAlgorithm,
+		KeyID:     transcriptSigner.keyID,
+		PublicKey: base64.StdEncoding.EncodeToString(public),
+		PEM:       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func runTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	runID := r.PathValue("id")
+	transcript, err := store.GetRunTranscript(runID)
+	if err != nil {
+		http.Error(w, "Error loading transcript", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error loading transcript", "run", runID, "error", err)
+		return
+	}
+
+	// Runs finished before transcripts existed have none
+	if transcript == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	filename := "prodle-run-" + strings.Map(func(r rune) rune {
+		if strings.ContainsRune("0123456789abcdef", r) {
+			return r
+		}
+		return -1
+	}, runID) + ".json"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(transcript)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTranscriptSigner(t *testing.T) *TranscriptSigner {
+	t.Helper()
+	public, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return &TranscriptSigner{key: key, keyID: transcriptKeyID(public)}
+}
+
+// testTranscript is a consistent run: the first target found on the second guess, the second on
+// the first, the third missed.
+func testTranscript() RunTranscript {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	ended := at(70)
+
+	transcript := RunTranscript{
+		Version:    transcriptVersion,
+		RunID:      "run-1",
+		Difficulty: DifficultyFacile,
+		TimeLimit:  DefaultGameSettings.TotalGameTimeSeconds,
+		Scoring:    DefaultGameSettings.Scoring,
+		StartTime:  start,
+		EndTime:    ended,
+		Lineup:     []string{"faker", "chovy", "caps"},
+		Targets: []TranscriptTarget{
+			{PlayerID: "faker", StartTime: start, Outcome: TargetFound, Guesses: []TranscriptGuess{
+				{PlayerID: "showmaker", Timestamp: at(10)},
+				{PlayerID: "faker", Timestamp: at(20), Correct: true},
+			}},
+			{PlayerID: "chovy", StartTime: at(20), Outcome: TargetFound, Guesses: []TranscriptGuess{
+				{PlayerID: "chovy", Timestamp: at(35), Correct: true},
+			}},
+			{PlayerID: "caps", StartTime: at(35), EndTime: &ended, Outcome: TargetMissed, Guesses: []TranscriptGuess{
+				{PlayerID: "perkz", Timestamp: at(60)},
+			}},
+		},
+	}
+
+	settings := DefaultGameSettings
+	settings.PlayersPerSession = len(transcript.Lineup)
+	transcript.Ledger, transcript.Score = ScoreLedger(settings, start, len(transcript.Lineup), transcript.Targets)
+	return transcript
+}
+
+func signTestTranscript(t *testing.T, signer *TranscriptSigner, transcript RunTranscript) []byte {
+	t.Helper()
+	data, err := signer.Sign(transcript)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return data
+}
+
+func TestVerifyTranscriptRoundTrip(t *testing.T) {
+	signer := testTranscriptSigner(t)
+	original := testTranscript()
+
+	verified, err := VerifyTranscript(signTestTranscript(t, signer, original), signer.PublicKey())
+	if err != nil {
+		t.Fatalf("VerifyTranscript: %v", err)
+	}
+
+	if verified.RunID != original.RunID || verified.Score != original.Score || !slices.Equal(verified.Ledger, original.Ledger) {
+		t.Errorf("verified transcript = %+v, want %+v", verified, original)
+	}
+	if len(verified.Ledger) != 2 || verified.Ledger[0].WrongGuesses != 1 || verified.Ledger[1].Target != 2 {
+		t.Errorf("ledger = %+v, want the two found targets and no completion bonus", verified.Ledger)
+	}
+}
+
+func TestVerifyTranscriptCompletionBonus(t *testing.T) {
+	signer := testTranscriptSigner(t)
+	transcript := testTranscript()
+	transcript.Lineup = transcript.Lineup[:2]
+	transcript.Targets = transcript.Targets[:2]
+
+	settings := DefaultGameSettings
+	settings.PlayersPerSession = 2
+	transcript.Ledger, transcript.Score = ScoreLedger(settings, transcript.StartTime, 2, transcript.Targets)
+
+	verified, err := VerifyTranscript(signTestTranscript(t, signer, transcript), signer.PublicKey())
+	if err != nil {
+		t.Fatalf("VerifyTranscript: %v", err)
+	}
+	if last := verified.Ledger[len(verified.Ledger)-1]; last.Reason != LedgerCompletionBonus || last.Points != DefaultGameSettings.Scoring.CompletionBonus {
+		t.Errorf("last ledger entry = %+v, want the completion bonus", last)
+	}
+}
+
+// Tampered transcripts signed again with the real key: the signature holds, the contents do not.
+func TestVerifyTranscriptTamperedContents(t *testing.T) {
+	signer := testTranscriptSigner(t)
+
+	tests := []struct {
+		name    string
+		tamper  func(*RunTranscript)
+		wantErr string
+	}{
+		{"ledger points", func(tr *RunTranscript) { tr.Ledger[0].Points += 500; tr.Score += 500 }, "ledger does not match"},
+		{"ledger entry added", func(tr *RunTranscript) {
+			tr.Ledger = append(tr.Ledger, ScoreLedgerEntry{Reason: LedgerCompletionBonus, Points: 10000})
+			tr.Score += 10000
+		}, "ledger does not match"},
+		{"ledger entry dropped", func(tr *RunTranscript) { tr.Ledger = tr.Ledger[:1] }, "ledger does not match"},
+		{"score", func(tr *RunTranscript) { tr.Score++ }, "does not match the recomputed"},
+		{"scoring rules", func(tr *RunTranscript) { tr.Scoring.BasePoints = 9000 }, "ledger does not match"},
+		{"invalid scoring rules", func(tr *RunTranscript) { tr.Scoring.TimeFactor = 2 }, "invalid transcript rules"},
+		{"guess out of order", func(tr *RunTranscript) {
+			tr.Targets[1].Guesses[0].Timestamp = tr.StartTime.Add(5 * time.Second)
+		}, "out of order"},
+		{"wrong guess marked correct", func(tr *RunTranscript) { tr.Targets[0].Guesses[0].Correct = true }, "inconsistent"},
+		{"target outside the lineup", func(tr *RunTranscript) { tr.Targets[1].PlayerID = "rekkles" }, "lineup says"},
+		{"missed target marked found", func(tr *RunTranscript) { tr.Targets[2].Outcome = TargetFound }, "outcome"},
+		{"more targets than the lineup", func(tr *RunTranscript) { tr.Lineup = tr.Lineup[:2] }, "targets for a lineup"},
+		{"future version", func(tr *RunTranscript) { tr.Version = transcriptVersion + 1 }, "unsupported transcript version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transcript := testTranscript()
+			tt.tamper(&transcript)
+
+			_, err := VerifyTranscript(signTestTranscript(t, signer, transcript), signer.PublicKey())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyTranscriptTamperedSignature(t *testing.T) {
+	signer := testTranscriptSigner(t)
+	other := testTranscriptSigner(t)
+	data := signTestTranscript(t, signer, testTranscript())
+
+	tests := []struct {
+		name    string
+		tamper  func(*SignedTranscript)
+		key     ed25519.PublicKey
+		wantErr string
+	}{
+		{"contents changed after signing", func(s *SignedTranscript) {
+			var transcript RunTranscript
+			json.Unmarshal(s.Transcript, &transcript)
+			transcript.Ledger[0].Points += 500
+			transcript.Score += 500
+			s.Transcript, _ = json.Marshal(transcript)
+		}, nil, "signature does not match"},
+		{"signature flipped", func(s *SignedTranscript) {
+			signature, _ := base64.StdEncoding.DecodeString(s.Signature)
+			signature[0] ^= 1
+			s.Signature = base64.StdEncoding.EncodeToString(signature)
+		}, nil, "signature does not match"},
+		{"signature not base64", func(s *SignedTranscript) { s.Signature = "not base64!" }, nil, "signature does not match"},
+		{"signed by another key", func(s *SignedTranscript) {
+			s.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(other.key, s.Transcript))
+		}, nil, "signature does not match"},
+		{"verified with another key", func(*SignedTranscript) {}, other.PublicKey(), "was signed with key"},
+		{"algorithm", func(s *SignedTranscript) { s.Algorithm = "RS256" }, nil, "unsupported signature algorithm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var signed SignedTranscript
+			if err := json.Unmarshal(data, &signed); err != nil {
+				t.Fatalf("failed to decode signed transcript: %v", err)
+			}
+			tt.tamper(&signed)
+			tampered, err := json.Marshal(signed)
+			if err != nil {
+				t.Fatalf("failed to encode signed transcript: %v", err)
+			}
+
+			key := tt.key
+			if key == nil {
+				key = signer.PublicKey()
+			}
+
+			_, err = VerifyTranscript(tampered, key)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := VerifyTranscript([]byte("not json"), signer.PublicKey()); err == nil {
+		t.Error("expected an error for a file that is not JSON")
+	}
+}
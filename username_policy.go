@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	defaultBlocklistPath = "data/username_blocklist.txt"
+	maxUsernameLength    = 50
+)
+
+const (
+	UsernameInvalidLength     = "username_length"
+	UsernameInvalidCharacters = "username_invalid_characters"
+	UsernameConfusable        = "username_confusable"
+	UsernameBlocked           = "username_blocked"
+	UsernameImpersonation     = "username_impersonation"
+	UsernameReserved          = "username_reserved"
+)
+
+type UsernameError struct {
+	Code    string
+	Message string
+}
+
+func (e *UsernameError) Error() string {
+	return e.Message
+}
+
+const (
+	minCollapsedTermLength = 3
+	// Shorter terms hide inside innocent names (Yoshitaka, Scunthorpe, Nazionale), so they only match whole words.
+	minSubstringTermLength = 5
+)
+
+type blockedTerm struct {
+	folded    string
+	collapsed string
+	wordOnly  bool
+}
+
+type UsernamePolicy struct {
+	// Blocked terms match anywhere in a folded name, or only on word boundaries when short;
+	// exact terms only match the whole name.
+	blockedTerms []blockedTerm
+	exactTerms   map[string]bool
+	proNames     map[string]bool
+}
+
+var usernamePolicy *UsernamePolicy
+
+// Letters from other scripts that render like Latin ones. Names mixing these scripts with Latin
+// are rejected outright; the mapping lets single-script lookalikes match blocked and pro names.
+var confusableLetters = map[rune]rune{
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't', 'у': 'y', 'х': 'x',
+	'ԝ': 'w', 'ё': 'e', 'ї': 'i',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	'ı': 'i', 'ȷ': 'j',
+}
+
+// Leetspeak and visually ambiguous characters fold onto one letter, so l, 1, | and i all match.
+var leetLetters = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i', '+': 't', '€': 'e', 'l': 'i',
+}
+
+// Characters that are letters to Unicode but render as blank space.
+var invisibleLetters = map[rune]bool{
+	'\u115F': true, '\u1160': true, '\u3164': true, '\uFFA0': true, '\u2800': true,
+}
+
+var confusableScripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek}
+
+// LoadUsernamePolicy reads the blocklist from USERNAME_BLOCKLIST (data/username_blocklist.txt by default)
+// and collects the pro player names from the loaded game data.
+func LoadUsernamePolicy() (*UsernamePolicy, error) {
+	policy := &UsernamePolicy{
+		exactTerms: make(map[string]bool),
+		proNames:   make(map[string]bool),
+	}
+
+	path := os.Getenv("USERNAME_BLOCKLIST")
+	if path == "" {
+		path = defaultBlocklistPath
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && path == defaultBlocklistPath {
+			slog.Warn("No username blocklist", "path", path)
+		} else {
+			return nil, fmt.Errorf("failed to open username blocklist: %v", err)
+		}
+	} else {
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			if term, exact := strings.CutPrefix(line, "="); exact {
+				if folded := foldUsername(term); folded != "" {
+					policy.exactTerms[folded] = true
+				}
+			} else if folded := foldUsername(line); folded != "" {
+				policy.blockedTerms = append(policy.blockedTerms, newBlockedTerm(folded))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read username blocklist: %v", err)
+		}
+	}
+
+	for _, name := range GetPlayerNameKeys() {
+		if folded := foldUsername(name); folded != "" {
+			policy.proNames[folded] = true
+		}
+	}
+
+	slog.Info("Username policy loaded", "blocked_terms", len(policy.blockedTerms)+len(policy.exactTerms), "pro_names", len(policy.proNames))
+	return policy, nil
+}
+
+func newBlockedTerm(folded string) blockedTerm {
+	return blockedTerm{
+		folded:    folded,
+		collapsed: collapseRepeats(folded),
+		wordOnly:  len(folded) < minSubstringTermLength,
+	}
+}
+
+// foldUsername reduces a name to a lowercase skeleton of ASCII-ish letters and digits, used only for comparisons.
+func foldUsername(name string) string {
+	name = cases.Fold().String(norm.NFKC.String(name))
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if mapped, ok := confusableLetters[r]; ok {
+			r = mapped
+		}
+		if mapped, ok := leetLetters[r]; ok {
+			r = mapped
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	folded := strings.ReplaceAll(b.String(), "rn", "m")
+	return strings.ReplaceAll(folded, "vv", "w")
+}
+
+// foldedWords folds each word of a name, words being split by anything other than a letter or a digit
+// and by a change from lower to upper case, as in "BigShit".
+func foldedWords(name string) []string {
+	var words []string
+	var word strings.Builder
+	var last rune
+	flush := func() {
+		if folded := foldUsername(word.String()); folded != "" {
+			words = append(words, folded)
+		}
+		word.Reset()
+	}
+
+	for _, r := range name {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || leetLetters[r] != 0
+		if !isWordRune || (unicode.IsUpper(r) && unicode.IsLower(last)) {
+			flush()
+		}
+		if isWordRune {
+			word.WriteRune(r)
+		}
+		last = r
+	}
+	flush()
+
+	return words
+}
+
+// containsWords reports whether term occurs in the joined words starting and ending on word boundaries,
+// so it may span several words ("n a z i") but not sit inside one.
+func containsWords(words []string, term string) bool {
+	boundaries := map[int]bool{0: true}
+	joined := ""
+	for _, word := range words {
+		joined += word
+		boundaries[len(joined)] = true
+	}
+
+	for start := 0; start < len(joined); start++ {
+		if boundaries[start] && strings.HasPrefix(joined[start:], term) && boundaries[start+len(term)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (t blockedTerm) matches(folded, collapsed string, words, collapsedWords []string) bool {
+	// Squeezed forms only count when enough of the term survives, or "kkk" would block every k
+	squeezed := len(t.collapsed) >= minCollapsedTermLength
+	if t.wordOnly {
+		return containsWords(words, t.folded) || (squeezed && containsWords(collapsedWords, t.collapsed))
+	}
+	return strings.Contains(folded, t.folded) || (squeezed && strings.Contains(collapsed, t.collapsed))
+}
+
+// collapseRepeats squeezes runs of the same letter so that stretched words still match.
+func collapseRepeats(s string) string {
+	var b strings.Builder
+	var last rune
+	for _, r := range s {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
+
+func mixesConfusableScripts(name string) bool {
+	seen := 0
+	for _, script := range confusableScripts {
+		for _, r := range name {
+			if unicode.Is(script, r) {
+				seen++
+				break
+			}
+		}
+	}
+	return seen > 1
+}
+
+// Check normalises a username and applies the policy, returning the name to store.
+// Verified players, who submit under their account name, may use a pro player's name.
+func (p *UsernamePolicy) Check(username string, verified bool) (string, error) {
+	name := norm.NFKC.String(username)
+
+	hasLetter := false
+	for _, r := range name {
+		if unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs) || invisibleLetters[r] || (unicode.IsSpace(r) && r != ' ') {
+			return "", &UsernameError{Code: UsernameInvalidCharacters, Message: "Username contains invisible or control characters"}
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			hasLetter = true
+		}
+	}
+
+	name = strings.Join(strings.Fields(name), " ")
+
+	if length := utf8.RuneCountInString(name); length == 0 || length > maxUsernameLength {
+		return "", &UsernameError{Code: UsernameInvalidLength, Message: "Username must be between 1 and 50 characters"}
+	}
+
+	if !hasLetter {
+		return "", &UsernameError{Code: UsernameInvalidCharacters, Message: "Username must contain a letter or a digit"}
+	}
+
+	if mixesConfusableScripts(name) {
+		return "", &UsernameError{Code: UsernameConfusable, Message: "Username mixes lookalike characters from different alphabets"}
+	}
+
+	folded := foldUsername(name)
+	collapsed := collapseRepeats(folded)
+
+	if p.exactTerms[folded] {
+		return "", &UsernameError{Code: UsernameBlocked, Message: "This username is not allowed"}
+	}
+	words := foldedWords(name)
+	collapsedWords := make([]string, len(words))
+	for i, word := range words {
+		collapsedWords[i] = collapseRepeats(word)
+	}
+	for _, term := range p.blockedTerms {
+		if term.matches(folded, collapsed, words, collapsedWords) {
+			return "", &UsernameError{Code: UsernameBlocked, Message: "This username is not allowed"}
+		}
+	}
+
+	if !verified && p.proNames[folded] {
+		return "", &UsernameError{Code: UsernameImpersonation, Message: "This username belongs to a pro player"}
+	}
+
+	return name, nil
+}
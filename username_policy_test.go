@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFoldUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Bob", "bob"},
+		{"B0B", "bob"},
+		{"\u0412\u041e\u0412", "bob"}, // Cyrillic ВОВ
+		{"\u0392\u03bf\u03b2", "bob"}, // Greek Βοβ
+		{"Ｆａｋｅｒ", "faker"},
+		{"Café Crème", "cafecreme"},
+		{"Straße", "strasse"},
+		{"Big-Shit", "bigshit"},
+		{"$h1t", "shit"},
+		{"l|1i", "iiii"},
+		{"corn", "com"},
+		{"vvin", "win"},
+		{"   ", ""},
+		{"---", ""},
+	}
+
+	for _, tt := range tests {
+		if got := foldUsername(tt.name); got != tt.want {
+			t.Errorf("foldUsername(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFoldedWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"Big Shit", []string{"big", "shit"}},
+		{"BigShit", []string{"big", "shit"}},
+		{"big_shit-2", []string{"big", "shit", "2"}},
+		{"N4z1", []string{"nazi"}},
+		{"$h1t", []string{"shit"}},
+		{"Yoshitaka", []string{"yoshitaka"}},
+		{"XXL", []string{"xxi"}},
+		{"  ", nil},
+	}
+
+	for _, tt := range tests {
+		if got := foldedWords(tt.name); !slices.Equal(got, tt.want) {
+			t.Errorf("foldedWords(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testUsernamePolicy(t *testing.T) *UsernamePolicy {
+	t.Helper()
+	t.Setenv("USERNAME_BLOCKLIST", defaultBlocklistPath)
+
+	policy, err := LoadUsernamePolicy()
+	if err != nil {
+		t.Fatalf("LoadUsernamePolicy: %v", err)
+	}
+	if len(policy.blockedTerms) == 0 || len(policy.exactTerms) == 0 {
+		t.Fatalf("no terms loaded from %s", defaultBlocklistPath)
+	}
+
+	policy.proNames[foldUsername("Faker")] = true
+	return policy
+}
+
+func TestUsernamePolicyCheck(t *testing.T) {
+	policy := testUsernamePolicy(t)
+
+	tests := []struct {
+		name     string
+		username string
+		verified bool
+		want     string // the stored name, or the error code
+	}{
+		{"plain", "Bob", false, "Bob"},
+		{"spaces collapsed", "  Bob   Smith ", false, "Bob Smith"},
+		{"fullwidth normalised", "Ｂｏｂ", false, "Bob"},
+		{"accents kept", "Élodie", false, "Élodie"},
+
+		// Innocent names containing a short blocked term
+		{"shit inside a word", "Yoshitaka", false, "Yoshitaka"},
+		{"cunt inside a word", "Scunthorpe", false, "Scunthorpe"},
+		{"nazi inside a word", "Nazionale", false, "Nazionale"},
+		{"ass inside a word", "Assassin", false, "Assassin"},
+		{"exact term inside a name", "Admin Bob", false, "Admin Bob"},
+		{"short term across a camel case boundary", "MisShitsuke", false, "MisShitsuke"},
+
+		{"short term alone", "shit", false, UsernameBlocked},
+		{"short term as a word", "Big Shit", false, UsernameBlocked},
+		{"short term as a camel case word", "BigShit", false, UsernameBlocked},
+		{"short term between underscores", "xX_nazi_Xx", false, UsernameBlocked},
+		{"short term in leetspeak", "N4z1", false, UsernameBlocked},
+		{"short term stretched", "Shiiiit", false, UsernameBlocked},
+		{"short term spelled out", "s h i t", false, UsernameBlocked},
+		{"listed compound", "Nazi88", false, UsernameBlocked},
+		{"long term inside a word", "xxHitlerxx", false, UsernameBlocked},
+		{"long term in leetspeak", "5al0pe", false, UsernameBlocked},
+		{"exact term", "ASS", false, UsernameBlocked},
+		{"exact term with punctuation", "A.d.m.i.n", false, UsernameBlocked},
+
+		// Lookalikes and invisible characters
+		{"single-script lookalike", "\u0455\u04bb\u0456\u0442", false, UsernameBlocked},
+		{"mixed scripts", "N\u0430zi", false, UsernameConfusable},
+		{"mixed scripts in an innocent name", "B\u043eb", false, UsernameConfusable},
+		{"zero-width space", "sh\u200bit", false, UsernameInvalidCharacters},
+		{"zero-width joiner", "Bob\u200d", false, UsernameInvalidCharacters},
+		{"right-to-left override", "\u202eboB", false, UsernameInvalidCharacters},
+		{"hangul filler", "\u3164", false, UsernameInvalidCharacters},
+		{"tab", "Bob\tSmith", false, UsernameInvalidCharacters},
+		{"no letter", "!!!", false, UsernameInvalidCharacters},
+		{"blank", "   ", false, UsernameInvalidLength},
+		{"too long", strings.Repeat("a", maxUsernameLength+1), false, UsernameInvalidLength},
+
+		{"pro name", "Faker", false, UsernameImpersonation},
+		{"pro name in leetspeak", "F4KER", false, UsernameImpersonation},
+		{"pro name for a verified player", "Faker", true, "Faker"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Check(tt.username, tt.verified)
+
+			var usernameErr *UsernameError
+			if errors.As(err, &usernameErr) {
+				if usernameErr.Code != tt.want {
+					t.Errorf("Check(%q) failed with %s, want %s", tt.username, usernameErr.Code, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check(%q): %v", tt.username, err)
+			}
+			if got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.username, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeBanValue(t *testing.T) {
+	tests := []struct {
+		kind    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{BanUsername, " Bob ", "bob", false},
+		{BanUsername, "B0b", "bob", false},
+		{BanUsername, "\u0412\u043eb", "bob", false},
+		{BanUsername, "---", "", true},
+		{BanUsername, "", "", true},
+		{BanIP, " 203.0.113.7 ", "203.0.113.7", false},
+		{BanIP, "2001:DB8::1", "2001:db8::1", false},
+		{BanIP, "bob", "", true},
+		{"email", "bob@example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeBanValue(tt.kind, tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeBanValue(%s, %q) = %q, %v, want %q", tt.kind, tt.value, got, err, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 func FormatDuration(seconds int) string {
@@ -32,58 +33,39 @@ func FormatDuration(seconds int) string {
 	return fmt.Sprintf("%d hours %d minutes %d seconds", hours, remainingMinutes, remainingSeconds)
 }
 
-func CalculatePlayerPoints(totalElapsedSeconds, wrongGuesses int) int {
+func CalculatePlayerPoints(settings GameSettings, totalElapsedSeconds, wrongGuesses int) int {
+	scoring := settings.Scoring
 
-	basePoints := 5000
-
-	timeProgress := float64(totalElapsedSeconds) / float64(TotalGameTime)
+	timeProgress := float64(totalElapsedSeconds) / float64(settings.TotalGameTimeSeconds)
 	if timeProgress > 1.0 {
 		timeProgress = 1.0
 	}
 
-	points := int(float64(basePoints) * (1.0 - 0.7*timeProgress))
+	points := int(float64(scoring.BasePoints) * (1.0 - scoring.TimeFactor*timeProgress))
 
-	penalty := wrongGuesses * 100
+	penalty := wrongGuesses * scoring.WrongGuessPenalty
 	points -= penalty
 
-	if points < 300 {
-		points = 300
+	if points < scoring.MinPoints {
+		points = scoring.MinPoints
 	}
 
 	return points
 }
 
-func CalculateGameScore(totalElapsedSeconds, totalWrongGuesses, playersFound int) int {
-
-	baseScore := playersFound * 3000
-	timePenalty := totalElapsedSeconds * 10
-	guessPenalty := totalWrongGuesses * 50
-
-	score := baseScore - timePenalty - guessPenalty
-	if score < 0 {
-		score = 0
-	}
-
-	return score
+// FormatClock renders seconds the way the game timer counts down, e.g. 2:00.
+func FormatClock(seconds int) string {
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
 }
 
-func CalculatePoints(elapsedSeconds int) int {
-
-	return CalculatePlayerPoints(elapsedSeconds, 0)
+// ElapsedSeconds is the whole seconds from start to at, on the wall clock so that
+// a transcript's timestamps give the same result as the live game.
+func ElapsedSeconds(start, at time.Time) int {
+	return int(at.Round(0).Sub(start.Round(0)).Seconds())
 }
 
-func CalculatePlayerScore(elapsedSeconds int, wrongGuesses int) int {
-	basePoints := CalculatePoints(elapsedSeconds)
-
-	penalty := wrongGuesses * 100
-
-	finalScore := basePoints - penalty
-
-	if finalScore < 0 {
-		finalScore = 0
-	}
-
-	return finalScore
+func EarnsCompletionBonus(playersFound, lineupSize int) bool {
+	return lineupSize > 0 && playersFound == lineupSize
 }
 
 func ValidatePlayerGuess(guess string) (bool, string) {